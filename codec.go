@@ -0,0 +1,1069 @@
+package plgo
+
+// #include "glue.h"
+import "C"
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"unsafe"
+)
+
+// codec converts values of one Go type to and from Perl.  Working out
+// how is done once per type, setSV() and getSV() just look it up.
+// Codecs run with the PL entered, so a whole argument list or result
+// tree converts without letting go of it.
+type codec struct {
+	enc func(pl *PL, ptr **C.SV, src reflect.Value, errf errFunc) bool
+	dec func(pl *PL, dst *reflect.Value, src *C.SV, errf errFunc) bool
+}
+
+var codecs sync.Map // reflect.Type => *codec
+
+var (
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	stringType = reflect.TypeOf("")
+	svType     = reflect.TypeOf((*sV)(nil))
+	fhType     = reflect.TypeOf((*perlFH)(nil))
+	readerType = reflect.TypeOf((*io.Reader)(nil)).Elem()
+	writerType = reflect.TypeOf((*io.Writer)(nil)).Elem()
+)
+
+func codecOf(t reflect.Type) *codec {
+	if c, ok := codecs.Load(t); ok {
+		return c.(*codec)
+	}
+	b := codecBuilder{}
+	c := b.codec(t)
+	// nothing is published until it is complete, a recursive type
+	// will have left more than one codec to publish
+	for t, c := range b {
+		codecs.LoadOrStore(t, c)
+	}
+	return c
+}
+
+// codecBuilder holds the codecs under construction, so recursive types
+// find their own.
+type codecBuilder map[reflect.Type]*codec
+
+func (b codecBuilder) codec(t reflect.Type) *codec {
+	if c, ok := codecs.Load(t); ok {
+		return c.(*codec)
+	}
+	if c, ok := b[t]; ok {
+		return c
+	}
+	c := new(codec)
+	b[t] = c
+	c.enc = b.enc(t)
+	c.dec = b.dec(t)
+	return c
+}
+
+func (b codecBuilder) enc(t reflect.Type) func(*PL, **C.SV, reflect.Value, errFunc) bool {
+	switch t.Kind() {
+	case reflect.Bool:
+		return func(pl *PL, ptr **C.SV, src reflect.Value, errf errFunc) bool {
+			C.glue_setBool(pl.thx, ptr, C.bool(src.Bool()))
+			return true
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(pl *PL, ptr **C.SV, src reflect.Value, errf errFunc) bool {
+			C.glue_setIV(pl.thx, ptr, C.IV(src.Int()))
+			return true
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return func(pl *PL, ptr **C.SV, src reflect.Value, errf errFunc) bool {
+			C.glue_setUV(pl.thx, ptr, C.UV(src.Uint()))
+			return true
+		}
+	case reflect.Float32, reflect.Float64:
+		return func(pl *PL, ptr **C.SV, src reflect.Value, errf errFunc) bool {
+			C.glue_setNV(pl.thx, ptr, C.NV(src.Float()))
+			return true
+		}
+	case reflect.Complex64, reflect.Complex128:
+		return func(pl *PL, ptr **C.SV, src reflect.Value, errf errFunc) bool {
+			if pl.newSVcmplx == nil {
+				pl.evalTrusted(`
+					require Math::Complex;
+					sub {
+						my $rv = Math::Complex->new(0, 0);
+						$rv->_set_cartesian([ @_ ]);
+						return $rv;
+					}
+				`, &pl.newSVcmplx)
+			}
+			v := src.Complex()
+			sv := pl.newSVcmplx(real(v), imag(v))
+			*ptr = sv.sv
+			return true
+		}
+	case reflect.Array,
+		reflect.Slice:
+		if t == viewType {
+			return func(pl *PL, ptr **C.SV, src reflect.Value, errf errFunc) bool {
+				pl.newView(ptr, src.Bytes())
+				return true
+			}
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			// []byte is special, Perl copies straight out of it
+			return func(pl *PL, ptr **C.SV, src reflect.Value, errf errFunc) bool {
+				var buf []byte
+				if src.Kind() == reflect.Slice {
+					buf = src.Bytes()
+				} else {
+					buf = make([]byte, src.Len())
+					reflect.Copy(reflect.ValueOf(buf), src)
+				}
+				var str unsafe.Pointer
+				if len(buf) > 0 {
+					str = unsafe.Pointer(&buf[0])
+				}
+				C.glue_setPVB(pl.thx, ptr, str, C.STRLEN(len(buf)))
+				return true
+			}
+		}
+		if enc := bulkEnc(t); enc != nil {
+			return enc
+		}
+		elem := b.codec(t.Elem())
+		return func(pl *PL, ptr **C.SV, src reflect.Value, errf errFunc) bool {
+			lst := make([]*C.SV, 1+src.Len())
+			for i := range lst[0 : len(lst)-1] {
+				if !elem.enc(pl, &lst[i], src.Index(i), errf) {
+					return false
+				}
+			}
+			C.glue_setAV(pl.thx, ptr, &lst[0])
+			return true
+		}
+	case reflect.Func:
+		return b.encFunc(t)
+	case reflect.Interface:
+		return func(pl *PL, ptr **C.SV, src reflect.Value, errf errFunc) bool {
+			if src.IsNil() {
+				C.glue_setUndef(pl.thx, ptr)
+				return true
+			}
+			if sv := pl.newFH(src); sv != nil {
+				*ptr = sv.sv
+				return true
+			}
+			return pl.encode(ptr, src.Elem(), errf)
+		}
+	case reflect.Map:
+		key := b.codec(t.Key())
+		elem := b.codec(t.Elem())
+		return func(pl *PL, ptr **C.SV, src reflect.Value, errf errFunc) bool {
+			lst := make([]*C.SV, src.Len()<<1+1)
+			i := 0
+			for it := src.MapRange(); it.Next(); i += 2 {
+				if !key.enc(pl, &lst[i], it.Key(), errf) {
+					return false
+				}
+				if !elem.enc(pl, &lst[i+1], it.Value(), errf) {
+					return false
+				}
+			}
+			C.glue_setHV(pl.thx, ptr, &lst[0])
+			return true
+		}
+	case reflect.Ptr:
+		// TODO: *sV handling is a special case, but generic Ptr support
+		// could be implemented
+		if t == svType {
+			return func(pl *PL, ptr **C.SV, src reflect.Value, errf errFunc) bool {
+				sv := src.Interface().(*sV)
+				if sv.pl != pl {
+					if errf(ErrForeign) {
+						return false
+					}
+					panic(ErrForeign)
+				}
+				// an owning wrapper, e.g. an error from Perl, keeps
+				// its reference, the rest carry one to hand over
+				if sv.own {
+					C.glue_inc(pl.thx, sv.sv)
+				}
+				*ptr = sv.sv
+				return true
+			}
+		}
+		if t == valueType || t == arrayType || t == hashType {
+			return func(pl *PL, ptr **C.SV, src reflect.Value, errf errFunc) bool {
+				if src.IsNil() {
+					C.glue_setUndef(pl.thx, ptr)
+					return true
+				}
+				var sv *sV
+				switch v := src.Interface().(type) {
+				case *Value:
+					sv = v.sv
+				case *Array:
+					sv = v.sv
+				case *Hash:
+					sv = v.sv
+				}
+				if sv.pl != pl {
+					if errf(ErrForeign) {
+						return false
+					}
+					panic(ErrForeign)
+				}
+				// a copy, so Perl assigning to an aliased arg
+				// leaves the handle be
+				*ptr = C.glue_copy(pl.thx, sv.sv)
+				return true
+			}
+		}
+		if t.Implements(readerType) || t.Implements(writerType) {
+			return func(pl *PL, ptr **C.SV, src reflect.Value, errf errFunc) bool {
+				if sv := pl.newFH(src); sv != nil {
+					*ptr = sv.sv
+					return true
+				}
+				return unhandled(src.Kind(), errf)
+			}
+		}
+	case reflect.String:
+		return func(pl *PL, ptr **C.SV, src reflect.Value, errf errFunc) bool {
+			str := src.String()
+			C.glue_setPV(pl.thx, ptr, C.CString(str), C.STRLEN(len(str)))
+			return true
+		}
+	case reflect.Struct:
+		return b.encStruct(t)
+	}
+	return func(pl *PL, ptr **C.SV, src reflect.Value, errf errFunc) bool {
+		return unhandled(src.Kind(), errf)
+	}
+}
+
+func unhandled(k reflect.Kind, errf errFunc) bool {
+	err := fmt.Errorf(`unhandled type "%s"`, k.String())
+	if errf(err) {
+		return false
+	}
+	panic(err)
+}
+
+func (b codecBuilder) encFunc(t reflect.Type) func(*PL, **C.SV, reflect.Value, errFunc) bool {
+	invoke := b.invoker(t, t.String())
+	return func(pl *PL, ptr **C.SV, src reflect.Value, errf errFunc) bool {
+		call := func(pl *PL, arg **C.SV, errp **C.SV) **C.SV {
+			defer pl.rethrow(errp)
+			return invoke(pl, src, arg, errf)
+		}
+		pl.liveMX.Lock()
+		pl.liveCBSeq++
+		id := pl.liveCBSeq
+		pl.liveCB[id] = &liveCBEnt{1, call, src}
+		pl.liveMX.Unlock()
+		C.glue_setCV(pl.thx, ptr, C.UV(id))
+		return true
+	}
+}
+
+// invoker works out how to call a Go func of type t with a NULL
+// terminated Perl arg list, returning its results as a new NULL
+// terminated array.  Bound funcs and struct methods both go through it,
+// desc names the callee in arity errors.
+func (b codecBuilder) invoker(t reflect.Type, desc string) func(*PL, reflect.Value, **C.SV, errFunc) **C.SV {
+	off := 0
+	if t.NumIn() > 0 && t.In(0) == contextType {
+		off = 1
+	}
+	ins := make([]*codec, t.NumIn())
+	for i := off; i < len(ins); i++ {
+		ins[i] = b.codec(t.In(i))
+	}
+	// the fixed args, a variadic func takes any more into its last
+	fixed := len(ins) - off
+	var rest *codec
+	if t.IsVariadic() {
+		fixed--
+		rest = b.codec(t.In(t.NumIn() - 1).Elem())
+	}
+	outs := make([]*codec, t.NumOut())
+	lists := false
+	for i := range outs {
+		if t.Out(i).Implements(listType) {
+			// a List is returned as its elements
+			outs[i] = b.codec(t.Out(i).Elem())
+			lists = true
+		} else {
+			outs[i] = b.codec(t.Out(i))
+		}
+	}
+	return func(pl *PL, fn reflect.Value, arg **C.SV, errf errFunc) (ret **C.SV) {
+		// xlate args - they are already mortal, don't take
+		// ownership unless they need to survive beyond the
+		// function call
+		lst := sliceOf(arg, lenOf(arg))
+		if len(lst) < fixed {
+			panic(fmt.Errorf("Too few arguments for %s (got %d; expected %d)", desc, len(lst), fixed))
+		}
+		if len(lst) > fixed && rest == nil {
+			panic(fmt.Errorf("Too many arguments for %s (got %d; expected %d)", desc, len(lst), fixed))
+		}
+		args := make([]reflect.Value, len(ins))
+		if off > 0 {
+			want := Want(C.glue_gimme(pl.thx))
+			args[0] = reflect.ValueOf(context.WithValue(pl.context(), wantKey{}, want))
+		}
+		for i, sv := range lst[:fixed] {
+			args[off+i] = reflect.New(t.In(off + i)).Elem()
+			ins[off+i].dec(pl, &args[off+i], sv, errf)
+		}
+		var vals []reflect.Value
+		if rest != nil {
+			more := lst[fixed:]
+			args[len(args)-1] = reflect.MakeSlice(t.In(t.NumIn()-1), len(more), len(more))
+			for i, sv := range more {
+				e := args[len(args)-1].Index(i)
+				rest.dec(pl, &e, sv, errf)
+			}
+			vals = fn.CallSlice(args)
+		} else {
+			vals = fn.Call(args)
+		}
+		// xlate rets - return as owning references and
+		// glue_invoke() will mortalize them for us
+		if lists {
+			return pl.encodeList(outs, vals, errf)
+		}
+		ret = C.glue_alloc(C.IV(1 + len(outs)))
+		rets := sliceOf(ret, len(outs))
+		for i, val := range vals {
+			outs[i].enc(pl, &rets[i], val, errf)
+		}
+		return
+	}
+}
+
+// stInfo is what a struct proxy needs to know about its type.  The C
+// strings are handed to every proxy and never freed.
+type stInfo struct {
+	name    *C.char
+	attrs   []*C.char // field names, NULL terminated
+	fields  map[string]stField
+	methods map[string]int
+	calls   []func(*PL, reflect.Value, **C.SV, errFunc) **C.SV
+}
+
+type stField struct {
+	index []int
+	c     *codec
+}
+
+// field finds a field by name, promoted fields are not in the map
+func (st *stInfo) field(t reflect.Type, name string) (stField, bool) {
+	if f, ok := st.fields[name]; ok {
+		return f, true
+	}
+	if sf, ok := t.FieldByName(name); ok {
+		return stField{sf.Index, codecOf(sf.Type)}, true
+	}
+	return stField{}, false
+}
+
+func (b codecBuilder) stInfo(t reflect.Type) *stInfo {
+	st := &stInfo{
+		name:    C.CString(t.PkgPath() + "/" + t.Name()),
+		attrs:   make([]*C.char, 1+t.NumField()),
+		fields:  make(map[string]stField, t.NumField()),
+		methods: make(map[string]int, t.NumMethod()),
+		calls:   make([]func(*PL, reflect.Value, **C.SV, errFunc) **C.SV, t.NumMethod()),
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		st.attrs[i] = C.CString(f.Name)
+		st.fields[f.Name] = stField{f.Index, b.codec(f.Type)}
+	}
+	for i := 0; i < t.NumMethod(); i++ {
+		m := t.Method(i)
+		st.methods[m.Name] = i
+		// the method value's type, without the receiver
+		in := make([]reflect.Type, m.Type.NumIn()-1)
+		for j := range in {
+			in[j] = m.Type.In(1 + j)
+		}
+		out := make([]reflect.Type, m.Type.NumOut())
+		for j := range out {
+			out[j] = m.Type.Out(j)
+		}
+		mt := reflect.FuncOf(in, out, m.Type.IsVariadic())
+		st.calls[i] = b.invoker(mt, t.Name()+"."+m.Name)
+	}
+	return st
+}
+
+func (b codecBuilder) encStruct(t reflect.Type) func(*PL, **C.SV, reflect.Value, errFunc) bool {
+	st := b.stInfo(t)
+	return func(pl *PL, ptr **C.SV, src reflect.Value, errf errFunc) bool {
+		ent := new(liveSTEnt)
+		pl.liveMX.Lock()
+		pl.liveSTSeq++
+		id := pl.liveSTSeq
+		pl.liveST[id] = ent
+		pl.liveMX.Unlock()
+		ent.getf = func(pl *PL, name *C.char) (rv *C.SV) {
+			// TODO: need an error proxy
+			f, ok := st.field(t, C.GoString(name))
+			if !ok {
+				return
+			}
+			f.c.enc(pl, &rv, src.FieldByIndex(f.index), errf)
+			return
+		}
+		ent.setf = func(pl *PL, name *C.char, sv *C.SV) {
+			// TODO: need an error proxy
+			f, ok := st.field(t, C.GoString(name))
+			if !ok {
+				return
+			}
+			val := src.FieldByIndex(f.index)
+			f.c.dec(pl, &val, sv, errf)
+		}
+		ent.call = func(pl *PL, name *C.char, arg **C.SV, errp **C.SV) (ret **C.SV) {
+			defer pl.rethrow(errp)
+			i, ok := st.methods[C.GoString(name)]
+			if !ok {
+				panic(fmt.Errorf("no method %s on %v", C.GoString(name), t))
+			}
+			return st.calls[i](pl, src.Method(i), arg, errf)
+		}
+		ent.src = src
+		ent.live = len(st.attrs) /* held by the wrap + each field stub */
+		C.glue_setObj(pl.thx, ptr, C.UV(id), st.name, &st.attrs[0])
+		return true
+	}
+}
+
+func (b codecBuilder) dec(t reflect.Type) func(*PL, *reflect.Value, *C.SV, errFunc) bool {
+	switch t.Kind() {
+	case reflect.Bool:
+		return func(pl *PL, dst *reflect.Value, src *C.SV, errf errFunc) bool {
+			var val C.bool
+			C.glue_getBool(pl.thx, &val, src)
+			dst.SetBool(bool(val))
+			return true
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(pl *PL, dst *reflect.Value, src *C.SV, errf errFunc) bool {
+			var val C.IV
+			C.glue_getIV(pl.thx, &val, src)
+			dst.SetInt(int64(val))
+			return true
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return func(pl *PL, dst *reflect.Value, src *C.SV, errf errFunc) bool {
+			var val C.UV
+			C.glue_getUV(pl.thx, &val, src)
+			dst.SetUint(uint64(val))
+			return true
+		}
+	case reflect.Float32, reflect.Float64:
+		return func(pl *PL, dst *reflect.Value, src *C.SV, errf errFunc) bool {
+			var val C.NV
+			C.glue_getNV(pl.thx, &val, src)
+			dst.SetFloat(float64(val))
+			return true
+		}
+	case reflect.Complex64, reflect.Complex128:
+		return func(pl *PL, dst *reflect.Value, src *C.SV, errf errFunc) bool {
+			if pl.valSVcmplx == nil {
+				pl.evalTrusted(`
+					require Math::Complex;
+					sub {
+						return Math::Complex::Re($_[0]), Math::Complex::Im($_[0]);
+					}
+				`, &pl.valSVcmplx)
+			}
+			// TODO: check if errf to decide if callee should panic
+			re, im := pl.valSVcmplx(pl.wrap(src, false))
+			dst.SetComplex(complex128(complex(re, im)))
+			return true
+		}
+	case reflect.Func:
+		return b.decFunc(t)
+	case reflect.Interface:
+		if t == errorType {
+			return func(pl *PL, dst *reflect.Value, src *C.SV, errf errFunc) bool {
+				dst.Set(reflect.ValueOf(pl.wrap(src, true)))
+				return true
+			}
+		}
+		// Perl filehandles can fill in for the io interfaces
+		if t.NumMethod() > 0 && fhType.Implements(t) {
+			return func(pl *PL, dst *reflect.Value, src *C.SV, errf errFunc) bool {
+				var isIO C.bool
+				isIO = C.glue_isIO(pl.thx, src)
+				if bool(isIO) {
+					pl.fhInit()
+					dst.Set(reflect.ValueOf(&perlFH{pl, pl.wrap(src, true)}))
+					return true
+				}
+				return unhandled(t.Kind(), errf)
+			}
+		}
+		if t.NumMethod() == 0 {
+			return b.decAny()
+		}
+	case reflect.Map:
+		key := b.codec(t.Key())
+		elem := b.codec(t.Elem())
+		return func(pl *PL, dst *reflect.Value, src *C.SV, errf errFunc) bool {
+			cb := func(raw **C.SV, iv C.IV) {
+				n := int(iv)
+				if n >= 0 {
+					dst.Set(reflect.MakeMap(t))
+					var k reflect.Value
+					for i, sv := range sliceOf(raw, n) {
+						switch i & 1 {
+						case 0:
+							k = reflect.New(t.Key()).Elem()
+							if !key.dec(pl, &k, sv, errf) {
+								return
+							}
+						case 1:
+							v := reflect.New(t.Elem()).Elem()
+							if !elem.dec(pl, &v, sv, errf) {
+								return
+							}
+							dst.SetMapIndex(k, v)
+						}
+					}
+				} else {
+					err := fmt.Errorf("unable to convert SV to Map")
+					if errf(err) {
+						return
+					}
+					panic(err)
+				}
+			}
+			ptr := C.UV(uintptr(unsafe.Pointer(&cb)))
+			C.glue_walkHV(pl.thx, src, ptr)
+			return true
+		}
+	case reflect.Ptr:
+		// TODO: for now we're only handling *plgo.sV wrapping
+		if t == svType {
+			return func(pl *PL, dst *reflect.Value, src *C.SV, errf errFunc) bool {
+				dst.Set(reflect.ValueOf(pl.wrap(src, false)))
+				return true
+			}
+		}
+		if t == valueType {
+			return func(pl *PL, dst *reflect.Value, src *C.SV, errf errFunc) bool {
+				dst.Set(reflect.ValueOf(&Value{pl.wrap(src, true)}))
+				return true
+			}
+		}
+		if t == arrayType || t == hashType {
+			return decHandle(t)
+		}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// []byte is special, strings are copied straight in
+			bulk := bulkDec(t)
+			return func(pl *PL, dst *reflect.Value, src *C.SV, errf errFunc) bool {
+				var str *C.char
+				var n C.STRLEN
+				if C.glue_getPVB(pl.thx, src, &str, &n) {
+					dst.SetBytes(C.GoBytes(unsafe.Pointer(str), C.int(n)))
+					return true
+				}
+				return bulk(pl, dst, src, errf)
+			}
+		}
+		if dec := bulkDec(t); dec != nil {
+			return dec
+		}
+		elem := b.codec(t.Elem())
+		return func(pl *PL, dst *reflect.Value, src *C.SV, errf errFunc) bool {
+			var err error
+			errh := func(ev error) bool {
+				err = ev
+				return true
+			}
+			cb := func(raw **C.SV, iv C.IV) {
+				n := int(iv)
+				if n >= 0 {
+					dst.Set(reflect.MakeSlice(t, n, n))
+					for i, sv := range sliceOf(raw, n) {
+						val := dst.Index(i)
+						if !elem.dec(pl, &val, sv, errh) {
+							return
+						}
+					}
+				} else {
+					errh(fmt.Errorf("unable to convert SV to Slice"))
+					return
+				}
+			}
+			ptr := C.UV(uintptr(unsafe.Pointer(&cb)))
+			C.glue_walkAV(pl.thx, src, ptr)
+			if err != nil {
+				if errf(err) {
+					return false
+				}
+				panic(err)
+			}
+			return true
+		}
+	case reflect.String:
+		return func(pl *PL, dst *reflect.Value, src *C.SV, errf errFunc) bool {
+			var str *C.char
+			var len C.STRLEN
+			C.glue_getPV(pl.thx, &str, &len, src)
+			dst.SetString(C.GoStringN(str, C.int(len)))
+			return true
+		}
+	case reflect.Struct:
+		return b.decStruct(t)
+	}
+	return func(pl *PL, dst *reflect.Value, src *C.SV, errf errFunc) bool {
+		return unhandled(t.Kind(), errf)
+	}
+}
+
+func (b codecBuilder) decFunc(t reflect.Type) func(*PL, *reflect.Value, *C.SV, errFunc) bool {
+	// a leading Context bounds the call rather than being passed
+	hasCtx := t.NumIn() > 0 && t.In(0) == contextType
+	async := t.NumOut() == 1 && t.Out(0) == futureType
+	list := false
+	for i := 0; i < t.NumOut(); i++ {
+		list = list || t.Out(i).Implements(listType)
+	}
+	off := 0
+	if hasCtx {
+		off = 1
+	}
+	ins := make([]*codec, t.NumIn()-off)
+	for i := range ins {
+		ins[i] = b.codec(t.In(off + i))
+	}
+	// a variadic func passes its last args to Perl one by one
+	if t.IsVariadic() {
+		ins[len(ins)-1] = b.codec(t.In(t.NumIn() - 1).Elem())
+	}
+	return func(pl *PL, dst *reflect.Value, src *C.SV, errf errFunc) bool {
+		// Did this come from Go in the first place?
+		var id C.UV
+		var hasID C.bool
+		hasID = C.glue_getId(pl.thx, src, &id, C.GLUE_CB)
+		if bool(hasID) {
+			pl.liveMX.RLock()
+			ent := pl.liveCB[uint(id)]
+			pl.liveMX.RUnlock()
+			dst.Set(ent.orig)
+			return true
+		}
+		// if not, try to translate
+		cv := pl.wrap(src, true)
+		if async {
+			return pl.asyncFunc(dst, cv, hasCtx, errf)
+		}
+		var call func([]reflect.Value) []reflect.Value
+		call = func(arg []reflect.Value) (outv []reflect.Value) {
+			if pl.away() {
+				pl.exec(func() { outv = call(arg) })
+				return
+			}
+			// This ends up looking a lot like Eval(), but we have input
+			// args to convert and an SV instead of a string to execute.
+
+			// first scan outputs, so we can get error handling correct
+			// asap.
+			outv = make([]reflect.Value, t.NumOut())
+			for i := range outv {
+				outv[i] = reflect.New(t.Out(i)).Elem()
+			}
+			ret, errh := splitErrs(outv)
+			if pl.closed() {
+				if errh(ErrClosed) {
+					return
+				}
+				panic(ErrClosed)
+			}
+			ctx := context.Background()
+			if hasCtx {
+				if c, ok := arg[0].Interface().(context.Context); ok {
+					ctx = c
+				}
+				arg = arg[1:]
+			}
+			if err := ctx.Err(); err != nil {
+				if errh(err) {
+					return
+				}
+				panic(err)
+			}
+			// hold the PL from converting the args to converting
+			// the rets
+			if err := pl.enterContext(ctx); err != nil {
+				if errh(err) {
+					return
+				}
+				panic(err)
+			}
+			defer pl.leave()
+
+			args := pl.encodeArgs(ins, arg, t.IsVariadic(), errh)
+			if args == nil {
+				return
+			}
+
+			sub, no := cv.sv, C.UV(len(ret))
+			if list {
+				// a List wants every result, so collect them in
+				// list context through a helper
+				pl.initListCall()
+				C.glue_inc(pl.thx, cv.sv)
+				args = append([]*C.SV{cv.sv}, args...)
+				sub, no = pl.listCall.sv, 1
+			}
+			rets := make([]*C.SV, 1+no)
+
+			// make the call
+			var esv *C.SV
+			// already entered, so this won't wait
+			pl.run(ctx, func() {
+				esv = C.glue_call_sv(pl.thx, sub, &args[0], &rets[0], no)
+			})
+			defer func() {
+				for _, sv := range rets {
+					C.glue_dec(pl.thx, sv)
+				}
+				C.glue_dec(pl.thx, esv)
+			}()
+			if esv != nil {
+				err := pl.perlErr(ctx, esv)
+				if errh(err) {
+					return
+				}
+				panic(err)
+			}
+
+			if list {
+				pl.copyOut(rets[0], ret, errh)
+				return
+			}
+			for i, v := range ret {
+				// try converting rvs, any missing are left zero
+				if rets[i] == nil {
+					break
+				}
+				if !pl.decode(&v, rets[i], errh) {
+					return
+				}
+			}
+			return
+		}
+		dst.Set(reflect.MakeFunc(t, call))
+		return true
+	}
+}
+
+// decAny fills in an empty interface with what best fits the SV.
+// Arrays and hashes become []interface{} and map[string]interface{},
+// Go values come back as they went in, and other refs become *Value.
+func (b codecBuilder) decAny() func(*PL, *reflect.Value, *C.SV, errFunc) bool {
+	lst := b.codec(reflect.TypeOf([]interface{}(nil)))
+	hash := b.codec(reflect.TypeOf(map[string]interface{}(nil)))
+	return func(pl *PL, dst *reflect.Value, src *C.SV, errf errFunc) bool {
+		var v reflect.Value
+		switch C.glue_svKind(pl.thx, src) {
+		case C.GLUE_UNDEF:
+			dst.SetZero()
+			return true
+		case C.GLUE_BOOL:
+			var b C.bool
+			C.glue_getBool(pl.thx, &b, src)
+			v = reflect.ValueOf(bool(b))
+		case C.GLUE_IV:
+			var iv C.IV
+			C.glue_getIV(pl.thx, &iv, src)
+			v = reflect.ValueOf(int(iv))
+		case C.GLUE_UV:
+			var uv C.UV
+			C.glue_getUV(pl.thx, &uv, src)
+			v = reflect.ValueOf(uint(uv))
+		case C.GLUE_NV:
+			var nv C.NV
+			C.glue_getNV(pl.thx, &nv, src)
+			v = reflect.ValueOf(float64(nv))
+		case C.GLUE_PV:
+			v = reflect.New(stringType).Elem()
+			codecOf(stringType).dec(pl, &v, src, errf)
+		case C.GLUE_AV:
+			v = reflect.New(reflect.TypeOf([]interface{}(nil))).Elem()
+			if !lst.dec(pl, &v, src, errf) {
+				return false
+			}
+		case C.GLUE_HV:
+			v = reflect.New(reflect.TypeOf(map[string]interface{}(nil))).Elem()
+			if !hash.dec(pl, &v, src, errf) {
+				return false
+			}
+		default:
+			v = reflect.ValueOf(&Value{pl.wrap(src, true)})
+			var id C.UV
+			if C.glue_refType(pl.thx, src) == C.SVt_PVCV && bool(C.glue_getId(pl.thx, src, &id, C.GLUE_CB)) {
+				pl.liveMX.RLock()
+				v = pl.liveCB[uint(id)].orig
+				pl.liveMX.RUnlock()
+			} else if bool(C.glue_getId(pl.thx, src, &id, C.GLUE_ST)) {
+				pl.liveMX.RLock()
+				v = pl.liveST[uint(id)].src
+				pl.liveMX.RUnlock()
+			}
+		}
+		dst.Set(v)
+		return true
+	}
+}
+
+// encodeArgs converts arg for a call to Perl, as a new NULL terminated
+// list, spreading out the last if variadic.  It returns nil on error.
+func (pl *PL) encodeArgs(ins []*codec, arg []reflect.Value, variadic bool, errf errFunc) []*C.SV {
+	vals := arg
+	if variadic {
+		last := arg[len(arg)-1]
+		vals = make([]reflect.Value, len(arg)-1, len(arg)-1+last.Len())
+		copy(vals, arg)
+		for i := 0; i < last.Len(); i++ {
+			vals = append(vals, last.Index(i))
+		}
+	}
+	args := make([]*C.SV, 1+len(vals))
+	for i, val := range vals {
+		c := ins[min(i, len(ins)-1)]
+		if !c.enc(pl, &args[i], val, errf) {
+			for _, sv := range args[:i] {
+				C.glue_dec(pl.thx, sv)
+			}
+			return nil
+		}
+	}
+	return args
+}
+
+func (b codecBuilder) decStruct(t reflect.Type) func(*PL, *reflect.Value, *C.SV, errFunc) bool {
+	st := &stInfo{fields: make(map[string]stField, t.NumField())}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		st.fields[f.Name] = stField{f.Index, b.codec(f.Type)}
+	}
+	key := b.codec(stringType)
+	return func(pl *PL, dst *reflect.Value, src *C.SV, errf errFunc) bool {
+		// Did this come from Go in the first place?
+		var id C.UV
+		var hasID C.bool
+		hasID = C.glue_getId(pl.thx, src, &id, C.GLUE_ST)
+		if bool(hasID) {
+			pl.liveMX.RLock()
+			ent := pl.liveST[uint(id)]
+			pl.liveMX.RUnlock()
+			dst.Set(ent.src)
+			return true
+		}
+		// if not, try to translate
+		var err error
+		errh := func(ev error) bool {
+			err = ev
+			return true
+		}
+		cb := func(raw **C.SV, n C.IV) {
+			dst.Set(reflect.New(t).Elem())
+			k := reflect.New(stringType).Elem()
+			for i, sv := range sliceOf(raw, int(n)) {
+				switch i & 1 {
+				case 0:
+					if !key.dec(pl, &k, sv, errh) {
+						return
+					}
+				case 1:
+					if f, ok := st.field(t, k.String()); ok {
+						v := dst.FieldByIndex(f.index)
+						if !f.c.dec(pl, &v, sv, errh) {
+							return
+						}
+					}
+				}
+			}
+		}
+		ptr := C.UV(uintptr(unsafe.Pointer(&cb)))
+		C.glue_walkHV(pl.thx, src, ptr)
+		if err != nil {
+			if errf(err) {
+				return false
+			}
+			panic(err)
+		}
+		return true
+	}
+}
+
+// bulkEnc converts slices of numbers or strings with a single call
+// into C, rather than one per element.  It returns nil for other types.
+func bulkEnc(t reflect.Type) func(*PL, **C.SV, reflect.Value, errFunc) bool {
+	et := t.Elem()
+	// a slice already laid out as C wants it is handed over as is
+	direct := func(size uintptr) bool {
+		return t.Kind() == reflect.Slice && et.Size() == size
+	}
+	switch et.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		as := direct(C.sizeof_IV)
+		return func(pl *PL, ptr **C.SV, src reflect.Value, errf errFunc) bool {
+			n := src.Len()
+			var lst *C.IV
+			if as {
+				lst = (*C.IV)(unsafe.Pointer(src.Pointer()))
+			} else {
+				buf := make([]C.IV, n+1)
+				for i := 0; i < n; i++ {
+					buf[i] = C.IV(src.Index(i).Int())
+				}
+				lst = &buf[0]
+			}
+			C.glue_setAVIV(pl.thx, ptr, lst, C.IV(n))
+			return true
+		}
+	case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		as := direct(C.sizeof_UV)
+		return func(pl *PL, ptr **C.SV, src reflect.Value, errf errFunc) bool {
+			n := src.Len()
+			var lst *C.UV
+			if as {
+				lst = (*C.UV)(unsafe.Pointer(src.Pointer()))
+			} else {
+				buf := make([]C.UV, n+1)
+				for i := 0; i < n; i++ {
+					buf[i] = C.UV(src.Index(i).Uint())
+				}
+				lst = &buf[0]
+			}
+			C.glue_setAVUV(pl.thx, ptr, lst, C.IV(n))
+			return true
+		}
+	case reflect.Float32, reflect.Float64:
+		as := direct(C.sizeof_NV)
+		return func(pl *PL, ptr **C.SV, src reflect.Value, errf errFunc) bool {
+			n := src.Len()
+			var lst *C.NV
+			if as {
+				lst = (*C.NV)(unsafe.Pointer(src.Pointer()))
+			} else {
+				buf := make([]C.NV, n+1)
+				for i := 0; i < n; i++ {
+					buf[i] = C.NV(src.Index(i).Float())
+				}
+				lst = &buf[0]
+			}
+			C.glue_setAVNV(pl.thx, ptr, lst, C.IV(n))
+			return true
+		}
+	case reflect.String:
+		return func(pl *PL, ptr **C.SV, src reflect.Value, errf errFunc) bool {
+			// pack the strings end to end
+			n := src.Len()
+			lens := make([]C.STRLEN, n+1)
+			size := 0
+			for i := 0; i < n; i++ {
+				size += src.Index(i).Len()
+			}
+			buf := make([]byte, size+1)
+			off := 0
+			for i := 0; i < n; i++ {
+				str := src.Index(i).String()
+				lens[i] = C.STRLEN(len(str))
+				off += copy(buf[off:], str)
+			}
+			C.glue_setAVPV(pl.thx, ptr, (*C.char)(unsafe.Pointer(&buf[0])), &lens[0], C.IV(n))
+			return true
+		}
+	}
+	return nil
+}
+
+// bulkDec is the reverse of bulkEnc(), for slices only.
+func bulkDec(t reflect.Type) func(*PL, *reflect.Value, *C.SV, errFunc) bool {
+	et := t.Elem()
+	var fill func(pl *PL, dst reflect.Value, src *C.SV, n C.IV)
+	switch et.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if et.Size() == C.sizeof_IV {
+			fill = func(pl *PL, dst reflect.Value, src *C.SV, n C.IV) {
+				C.glue_getAVIV(pl.thx, src, (*C.IV)(unsafe.Pointer(dst.Pointer())), n)
+			}
+			break
+		}
+		fill = func(pl *PL, dst reflect.Value, src *C.SV, n C.IV) {
+			buf := make([]C.IV, n+1)
+			C.glue_getAVIV(pl.thx, src, &buf[0], n)
+			for i, v := range buf[:n] {
+				dst.Index(i).SetInt(int64(v))
+			}
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if et.Size() == C.sizeof_UV {
+			fill = func(pl *PL, dst reflect.Value, src *C.SV, n C.IV) {
+				C.glue_getAVUV(pl.thx, src, (*C.UV)(unsafe.Pointer(dst.Pointer())), n)
+			}
+			break
+		}
+		fill = func(pl *PL, dst reflect.Value, src *C.SV, n C.IV) {
+			buf := make([]C.UV, n+1)
+			C.glue_getAVUV(pl.thx, src, &buf[0], n)
+			for i, v := range buf[:n] {
+				dst.Index(i).SetUint(uint64(v))
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		if et.Size() == C.sizeof_NV {
+			fill = func(pl *PL, dst reflect.Value, src *C.SV, n C.IV) {
+				C.glue_getAVNV(pl.thx, src, (*C.NV)(unsafe.Pointer(dst.Pointer())), n)
+			}
+			break
+		}
+		fill = func(pl *PL, dst reflect.Value, src *C.SV, n C.IV) {
+			buf := make([]C.NV, n+1)
+			C.glue_getAVNV(pl.thx, src, &buf[0], n)
+			for i, v := range buf[:n] {
+				dst.Index(i).SetFloat(float64(v))
+			}
+		}
+	case reflect.String:
+		fill = func(pl *PL, dst reflect.Value, src *C.SV, n C.IV) {
+			strs := make([]*C.char, n+1)
+			lens := make([]C.STRLEN, n+1)
+			C.glue_getAVPV(pl.thx, src, &strs[0], &lens[0], n)
+			for i, str := range strs[:n] {
+				dst.Index(i).SetString(C.GoStringN(str, C.int(lens[i])))
+			}
+		}
+	default:
+		return nil
+	}
+	return func(pl *PL, dst *reflect.Value, src *C.SV, errf errFunc) bool {
+		n := C.glue_lenAV(pl.thx, src)
+		if n < 0 {
+			err := fmt.Errorf("unable to convert SV to Slice")
+			if errf(err) {
+				return false
+			}
+			panic(err)
+		}
+		dst.Set(reflect.MakeSlice(t, int(n), int(n)))
+		fill(pl, *dst, src, n)
+		return true
+	}
+}
@@ -0,0 +1,189 @@
+package plgo_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tlby/plgo"
+)
+
+type tree struct {
+	Name string
+	Kids []tree
+	Tags map[string]*tree
+}
+
+func TestCodec(t *testing.T) {
+	// a recursive type, decoded from many interpreters at once
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pl := plgo.New()
+			defer pl.Close()
+			var v tree
+			pl.Eval(`{ Name => "a", Kids => [ { Name => "b" }, { Name => "c", Kids => [ { Name => "d" } ] } ] }`, &v)
+			if v.Name != "a" || len(v.Kids) != 2 || v.Kids[1].Kids[0].Name != "d" {
+				t.Errorf("tree => %+v", v)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// struct proxies find fields and methods by name
+	pl := plgo.New()
+	defer pl.Close()
+	var name func(tree) (string, int, error)
+	pl.Eval(`sub { $_[0]{Name}, scalar @{ $_[0]{Kids} } }`, &name)
+	s, n, err := name(tree{Name: "x", Kids: make([]tree, 3)})
+	if err != nil || s != "x" || n != 3 {
+		t.Errorf("name() => %q, %v, %v", s, n, err)
+	}
+}
+
+type celsius float32
+
+func TestBulk(t *testing.T) {
+	pl := plgo.New()
+	defer pl.Close()
+	var sum func([]int, []int32, []uint16, []float64, []celsius) float64
+	pl.Eval(`sub { my $t = 0; $t += $_ for map @$_, @_; $t }`, &sum)
+	if v := sum([]int{1, -2}, []int32{3}, []uint16{4}, []float64{0.5}, []celsius{0.25}); v != 6.75 {
+		t.Errorf("sum() => %v", v)
+	}
+	var join func([]string) string
+	pl.Eval(`sub { join ",", map length, @{ $_[0] } }`, &join)
+	if v := join([]string{"a", "", "b\x00c", "ü"}); v != "1,0,3,2" {
+		t.Errorf("join() => %q", v)
+	}
+	if v := join(nil); v != "" {
+		t.Errorf("join(nil) => %q", v)
+	}
+
+	var ints []int
+	var i8s []int8
+	var fs []float64
+	var f32s []celsius
+	var us []uint
+	var strs []string
+	pl.Eval(`my @a = (1, 2); $a[4] = -3; \@a`, &ints)
+	pl.Eval(`[ 1, 2, 300 ]`, &i8s)
+	pl.Eval(`[ 0.5, "1e3" ]`, &fs)
+	pl.Eval(`[ 0.5, 1 ]`, &f32s)
+	pl.Eval(`[ 7, 8 ]`, &us)
+	pl.Eval(`[ "a", 2, "b\0c" ]`, &strs)
+	if !reflect.DeepEqual(ints, []int{1, 2, 0, 0, -3}) ||
+		!reflect.DeepEqual(i8s, []int8{1, 2, 44}) ||
+		!reflect.DeepEqual(fs, []float64{0.5, 1000}) ||
+		!reflect.DeepEqual(f32s, []celsius{0.5, 1}) ||
+		!reflect.DeepEqual(us, []uint{7, 8}) ||
+		!reflect.DeepEqual(strs, []string{"a", "2", "b\x00c"}) {
+		t.Errorf("got %v %v %v %v %v %q", ints, i8s, fs, f32s, us, strs)
+	}
+	// a tied array only has what FETCH returns
+	var anys []interface{}
+	tied := `require Tie::Array; tie my @t, "Tie::StdArray"; @t = (5, "x", 6); \@t`
+	pl.Eval(tied, &ints)
+	pl.Eval(tied, &strs)
+	pl.Eval(tied, &anys)
+	if !reflect.DeepEqual(ints, []int{5, 0, 6}) ||
+		!reflect.DeepEqual(strs, []string{"5", "x", "6"}) ||
+		!reflect.DeepEqual(anys, []interface{}{5, "x", 6}) {
+		t.Errorf("tied => %v %q %v", ints, strs, anys)
+	}
+
+	var err error
+	pl.Eval(`+{}`, &ints, &err)
+	if err == nil {
+		t.Errorf("hash into []int should fail")
+	}
+}
+
+func TestVariadic(t *testing.T) {
+	pl := plgo.New()
+	defer pl.Close()
+
+	// Perl calling variadic Go
+	var try func(interface{}) string
+	pl.Eval(`sub { my $f = shift; join "|", map { my @a = @$_; eval { $f->(@a) } // $@ =~ s/ at .*//sr } [ "-" ], [ "-", 1 ], [ "+", 1, 2, 3 ] }`, &try)
+	sum := func(op string, n ...int) string {
+		return op + fmt.Sprint(n)
+	}
+	if v := try(sum); v != "-[]|-[1]|+[1 2 3]" {
+		t.Errorf("try(sum) => %q", v)
+	}
+	add := func(a, b int) int { return a + b }
+	if v := try(add); v != "Too few arguments for func(int, int) int (got 1; expected 2)|1|Too many arguments for func(int, int) int (got 4; expected 2)" {
+		t.Errorf("try(add) => %q", v)
+	}
+	if v := try(func(string, ...int) {}); v != "||" {
+		t.Errorf("try(nothing) => %q", v)
+	}
+	var kinds func(func(...interface{}) string) string
+	pl.Eval(`sub { $_[0]->(1, "a", 2.5, [ 1 ], { k => "v" }, undef, sub { }, -1, ~0) }`, &kinds)
+	if v := kinds(func(vals ...interface{}) string {
+		s := make([]string, len(vals))
+		for i, v := range vals {
+			s[i] = fmt.Sprintf("%T", v)
+		}
+		return strings.Join(s, " ")
+	}); v != "int string float64 []interface {} map[string]interface {} <nil> *plgo.Value int uint" {
+		t.Errorf("kinds() => %q", v)
+	}
+
+	// methods check their args the same way
+	var meth func(AStruct) string
+	pl.Eval(`sub { join "|", map { my($m, @a) = @$_; eval { $_[0]->$m(@a) } // $@ =~ s/ at .*//sr } [ "AMethod" ], [ "AMethod", 1 ], [ "AMethod", 1, 2 ], [ "ASum" ], [ "ASum", 1, 2, 3 ] }`, &meth)
+	if v := meth(AStruct{I: 4}); v != "Too few arguments for AStruct.AMethod (got 0; expected 1)|5|Too many arguments for AStruct.AMethod (got 2; expected 1)|4|10" {
+		t.Errorf("meth() => %q", v)
+	}
+
+	// Go calling variadic Perl
+	var join func(string, ...string) string
+	pl.Eval(`sub { my $s = shift; join $s, @_ }`, &join)
+	if v := join("-", "a", "b", "c"); v != "a-b-c" {
+		t.Errorf("join() => %q", v)
+	}
+	if v := join("-"); v != "" {
+		t.Errorf("join() => %q", v)
+	}
+
+	// anything decodes into interface{}
+	var v interface{}
+	pl.Eval(`{ a => [ 1, "x", 1.5 ] }`, &v)
+	if !reflect.DeepEqual(v, map[string]interface{}{"a": []interface{}{1, "x", 1.5}}) {
+		t.Errorf("any => %#v", v)
+	}
+	var id func(interface{}) interface{}
+	pl.Eval(`sub { $_[0] }`, &id)
+	if f, ok := id(func() int { return 7 }).(func() int); !ok || f() != 7 {
+		t.Errorf("id(func) => %T", f)
+	}
+}
+
+func BenchmarkInFloats(b *testing.B) {
+	v := make([]float64, 10000)
+	var fn func([]float64)
+	pl := plgo.New()
+	defer pl.Close()
+	pl.Eval(`sub {}`, &fn)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fn(v)
+	}
+}
+
+func BenchmarkRvFloats(b *testing.B) {
+	var fn func() []float64
+	pl := plgo.New()
+	defer pl.Close()
+	pl.Eval(`sub { [ (0.5) x 10000 ] }`, &fn)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fn()
+	}
+}
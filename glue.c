@@ -2,6 +2,7 @@
 #include "glue.h"
 #include "XSUB.h"
 #include "_cgo_export.h"
+#include <poll.h>
 
 /* notes: pretty much any char* coming from Go is going to callee
  * allocated and caller freed so that the go side isn't peppered with
@@ -9,6 +10,23 @@
 
 void xs_init (pTHX); /* provided by perlxsi.c */
 
+/* per interpreter state */
+#define MY_CXT_KEY "plgo::_guts"
+typedef struct {
+    IV interrupt;  /* cancelled calls still in progress */
+    IV depth;      /* nesting of calls from Go into Perl */
+    IV max_ops;    /* budgets for each outermost call, 0 for none */
+    IV max_live;
+    IV ops;        /* spent so far by the outermost call */
+    IV next_live;  /* op count to next check live SVs at */
+    IV tripped;    /* which budget ran out, if any */
+    bool exiting;  /* exit() was called, unwinding back to Go */
+    IV exit_code;
+} my_cxt_t;
+START_MY_CXT
+
+static IV count_live(pTHX);
+
 /* A little macro nuttiness to get Perl errors report the correct file
  * and line. */
 #define STRINGY_FLAT(x) #x
@@ -29,8 +47,174 @@ static const char *perl_runtime =
             return $tgt; \n\
         } \n\
     } \n\
+    package Go::Loop { \n\
+        # timers and I/O watchers, called back by PL.RunLoop().  The \n\
+        # hooks into Go are filled in for each interpreter. \n\
+        our($timer, $io, $cancel); \n\
+        $INC{'Go/Loop.pm'} = __FILE__; \n\
+        sub import { \n\
+            my $pkg = caller; \n\
+            no strict 'refs'; \n\
+            *{qq(${pkg}::$_)} = \\&$_ for qw(after every io cancel); \n\
+        } \n\
+        sub _cb { \n\
+            return $_[0] if ref $_[0] eq 'CODE'; \n\
+            require Carp; \n\
+            Carp::croak('callback must be a CODE ref'); \n\
+        } \n\
+        # after($seconds, $cb) calls $cb once \n\
+        sub after { \n\
+            my($secs, $cb) = @_; \n\
+            return $timer->(0 + $secs, 0, _cb($cb)); \n\
+        } \n\
+        # every($seconds, $cb) calls $cb until cancelled \n\
+        sub every { \n\
+            my($secs, $cb) = @_; \n\
+            unless($secs > 0) { \n\
+                require Carp; \n\
+                Carp::croak('every() needs a positive interval'); \n\
+            } \n\
+            return $timer->(0 + $secs, 1, _cb($cb)); \n\
+        } \n\
+        # io($fh, 'r' or 'w', $cb) calls $cb whenever $fh is ready, \n\
+        # until cancelled.  Cancel it before closing $fh. \n\
+        sub io { \n\
+            my($fh, $mode, $cb) = @_; \n\
+            my $fd = fileno $fh; \n\
+            unless(defined $fd and $fd >= 0 and $mode =~ /^[rw]$/) { \n\
+                require Carp; \n\
+                Carp::croak('io() needs a file descriptor and a mode of r or w'); \n\
+            } \n\
+            return $io->($fd, $mode eq 'w', _cb($cb)); \n\
+        } \n\
+        # cancel($id) stops a watcher, true if it was active \n\
+        sub cancel { \n\
+            return $cancel->(0 + $_[0]); \n\
+        } \n\
+    } \n\
     package Go::Pxy { \n\
-        # empty for now \n\
+        # keep AUTOLOAD from seeing object destruction \n\
+        sub DESTROY { } \n\
+    } \n\
+    package Go::Handle { \n\
+        use Symbol (); \n\
+        # a tied filehandle that forwards I/O to Go closures \n\
+        sub new { \n\
+            my($class, @ops) = @_; \n\
+            my $fh = Symbol::gensym(); \n\
+            tie *$fh, $class, @ops; \n\
+            return $fh; \n\
+        } \n\
+        sub TIEHANDLE { \n\
+            my($class, $read, $write, $close) = @_; \n\
+            return bless { \n\
+                read => $read, \n\
+                write => $write, \n\
+                close => $close, \n\
+                buf => '', \n\
+                eof => 0, \n\
+            }, $class; \n\
+        } \n\
+        sub _fail { \n\
+            my($self, $err) = @_; \n\
+            require Errno; \n\
+            $! = Errno::EIO(); \n\
+            $self->{err} = $err; \n\
+            return undef; \n\
+        } \n\
+        # returns bytes buffered, 0 at eof or undef on error \n\
+        sub _fill { \n\
+            my($self) = @_; \n\
+            return 0 if $self->{eof}; \n\
+            my($data, $err) = $self->{read}->(8192); \n\
+            return $self->_fail($err) if length $err; \n\
+            $self->{eof} = 1 unless length $data; \n\
+            $self->{buf} .= $data; \n\
+            return length $data; \n\
+        } \n\
+        sub _write { \n\
+            my($self, $data) = @_; \n\
+            my($n, $err) = $self->{write}->($data); \n\
+            return $self->_fail($err) if length $err; \n\
+            return $n; \n\
+        } \n\
+        sub READLINE { \n\
+            my($self) = @_; \n\
+            if(wantarray) { \n\
+                my(@lines, $line); \n\
+                push @lines, $line while defined($line = $self->READLINE); \n\
+                return @lines; \n\
+            } \n\
+            my $sep = $/; \n\
+            if(not defined $sep) { \n\
+                1 while $self->_fill; \n\
+            } elsif(ref $sep) { \n\
+                my $want = $$sep; \n\
+                1 while length $self->{buf} < $want and $self->_fill; \n\
+                return substr $self->{buf}, 0, $want, '' \n\
+                    if length $self->{buf}; \n\
+            } else { \n\
+                my $i; \n\
+                $sep = qq(\\n\\n) if $sep eq ''; \n\
+                1 while ($i = index $self->{buf}, $sep) < 0 and $self->_fill; \n\
+                return substr $self->{buf}, 0, $i + length $sep, '' \n\
+                    if $i >= 0; \n\
+            } \n\
+            return undef unless length $self->{buf}; \n\
+            return substr $self->{buf}, 0, length $self->{buf}, ''; \n\
+        } \n\
+        sub READ { \n\
+            my($self, undef, $len, $off) = @_; \n\
+            my $ok = 1; \n\
+            while(length $self->{buf} < $len) { \n\
+                my $n = $self->_fill; \n\
+                $ok = 0 unless defined $n; \n\
+                last unless $n; \n\
+            } \n\
+            return undef unless $ok or length $self->{buf}; \n\
+            my $data = substr $self->{buf}, 0, $len, ''; \n\
+            $off = 0 unless defined $off; \n\
+            $_[1] = '' unless defined $_[1]; \n\
+            $_[1] .= qq(\\0) x ($off - length $_[1]) if $off > length $_[1]; \n\
+            substr($_[1], $off) = $data; \n\
+            return length $data; \n\
+        } \n\
+        sub GETC { \n\
+            my($self) = @_; \n\
+            my $c; \n\
+            return $self->READ($c, 1) ? $c : undef; \n\
+        } \n\
+        sub WRITE { \n\
+            my($self, $buf, $len, $off) = @_; \n\
+            $off = 0 unless defined $off; \n\
+            $len = length($buf) - $off unless defined $len; \n\
+            return $self->_write(substr $buf, $off, $len); \n\
+        } \n\
+        sub PRINT { \n\
+            my $self = shift; \n\
+            my $data = join defined $, ? $, : '', @_; \n\
+            $data .= $\\ if defined $\\; \n\
+            return defined $self->_write($data) ? 1 : undef; \n\
+        } \n\
+        sub PRINTF { \n\
+            my $self = shift; \n\
+            my $fmt = shift; \n\
+            return defined $self->_write(sprintf $fmt, @_) ? 1 : undef; \n\
+        } \n\
+        sub BINMODE { 1 } \n\
+        sub FILENO { undef } \n\
+        sub EOF { \n\
+            my($self) = @_; \n\
+            return 0 if length $self->{buf}; \n\
+            return !$self->_fill; \n\
+        } \n\
+        sub CLOSE { \n\
+            my($self) = @_; \n\
+            my $err = $self->{close}->(); \n\
+            $self->{buf} = ''; \n\
+            $self->{eof} = 1; \n\
+            return length $err ? $self->_fail($err) : 1; \n\
+        } \n\
     } \n\
 ";
 
@@ -41,7 +225,7 @@ typedef struct {
 
 static int vtbl_st_sv_free(pTHX_ SV *sv, MAGIC *mg) {
     glue_st_t *st = (glue_st_t *)mg->mg_ptr;
-    goReleaseST(st->st_id);
+    goReleaseST(my_perl, st->st_id);
     if(st->st_fname)
         free(st->st_fname);
     return 0;
@@ -49,15 +233,30 @@ static int vtbl_st_sv_free(pTHX_ SV *sv, MAGIC *mg) {
 
 static int vtbl_stf_getf(pTHX_ SV *sv, MAGIC *mg) {
     glue_st_t *st = (glue_st_t *)mg->mg_ptr;
-    sv_setsv(sv, goSTGetf(st->st_id, st->st_fname));
+    sv_setsv(sv, goSTGetf(my_perl, st->st_id, st->st_fname));
+    glue_setContext(aTHX);
     return 0;
 }
 
 static int vtbl_stf_setf(pTHX_ SV *sv, MAGIC *mg) {
     glue_st_t *st = (glue_st_t *)mg->mg_ptr;
-    goSTSetf(st->st_id, st->st_fname, sv);
+    goSTSetf(my_perl, st->st_id, st->st_fname, sv);
+    glue_setContext(aTHX);
+    return 0;
+}
+
+#ifdef USE_ITHREADS
+/* perl_clone() has copied the struct, but not what it points to */
+static int vtbl_st_dup(pTHX_ MAGIC *mg, CLONE_PARAMS *param) {
+    glue_st_t *st = (glue_st_t *)mg->mg_ptr;
+    goDupST(param->proto_perl, st->st_id);
+    if(st->st_fname)
+        st->st_fname = strdup(st->st_fname);
     return 0;
 }
+#else
+#define vtbl_st_dup 0
+#endif
 
 static MGVTBL vtbl_st = {
     0,
@@ -65,6 +264,8 @@ static MGVTBL vtbl_st = {
     0,
     0,
     vtbl_st_sv_free,
+    0,
+    vtbl_st_dup,
 };
 static MGVTBL vtbl_stf = {
     vtbl_stf_getf,
@@ -72,12 +273,41 @@ static MGVTBL vtbl_stf = {
     0,
     0,
     vtbl_st_sv_free,
+    0,
+    vtbl_st_dup,
 };
 
+/* A Go callback that panics hands back an owned exception in place of
+ * its return values, raise it here where unwinding the stack is safe */
+static void rethrow(pTHX_ SV **ret, SV *err) {
+    int i;
+    if(ret) {
+        for(i = 0; ret[i]; i++)
+            SvREFCNT_dec(ret[i]);
+        free(ret);
+    }
+    croak_sv(sv_2mortal(err));
+}
+
+/* Move the NULL terminated results of a Go call onto the stack from
+ * ax on, growing it to fit since a List may return more than the args
+ * left room for, and free the array.  Returns how many there were. */
+static int retlist(pTHX_ I32 ax, SV **ret) {
+    SV **sp = PL_stack_base + ax - 1;
+    int i, n;
+
+    for(n = 0; ret[n]; n++);
+    EXTEND(sp, n);
+    for(i = 0; i < n; i++)
+        PL_stack_base[ax + i] = sv_2mortal(ret[i]);
+    free(ret);
+    return n;
+}
+
 XS(glue_autoload) {
     dXSARGS;
     MAGIC *mg;
-    SV **arg, **ret;
+    SV **arg, **ret, *err = NULL;
     int i;
 
     STRLEN l;
@@ -100,38 +330,249 @@ XS(glue_autoload) {
     for(i = 0; i < items - 1; i++)
         arg[i] = ST(i + 1);
     arg[i] = NULL;
-    ret = (SV **)goSTCall(st->st_id, name, arg);
+    ret = (SV **)goSTCall(my_perl, st->st_id, name, arg, &err);
+    glue_setContext(aTHX);
+    if(err)
+        rethrow(aTHX_ ret, err);
     /* rets must be mortalized on the way out */
-    for(i = 0; ret[i]; i++)
-        ST(i) = sv_2mortal(ret[i]);
-    free(ret);
-    XSRETURN(i);
+    XSRETURN(retlist(aTHX_ ax, ret));
+}
+
+/* replace %ENV with an isolated copy that does not touch the process
+ * environment */
+static void glue_setEnv(pTHX_ char **env) {
+    HV *hv = GvHVn(PL_envgv);
+    char **ent;
+
+    sv_unmagic((SV *)hv, PERL_MAGIC_env);
+    hv_clear(hv);
+    for(ent = env; *ent; ent++) {
+        char *eq = strchr(*ent, '=');
+        SV *sv = newSVpv(eq + 1, 0);
+        SvTAINTED_on(sv);
+        hv_store(hv, *ent, eq - *ent, sv, 0);
+        free(*ent);
+    }
+    free(env);
+}
+
+/* Go asks for Perl code to stop by marking a signal as pending, this
+ * runs at the next safe point in place of the usual signal dispatch */
+static void glue_sighook(pTHX) {
+    dMY_CXT;
+    if(MY_CXT.interrupt > 0) {
+        /* stay pending so that eval {} can not swallow the interrupt */
+        PL_sig_pending = 1;
+        croak_sv(sv_2mortal(sv_bless(newRV_noinc(newSV(0)),
+            gv_stashpv("Go::Cancel", GV_ADD))));
+    }
+    despatch_signals();
+}
+
+/* the Go::Exit exception for the pending exit() */
+static SV *exit_sv(pTHX_ IV code) {
+    return sv_2mortal(sv_bless(newRV_noinc(newSViv(code)),
+        gv_stashpv("Go::Exit", GV_ADD)));
 }
 
-tTHX glue_init() {
-    int argc = 3;
-    char *argv[] = { "", "-e", "0", NULL };
-    
+/* exit() would take the whole Go process with it, so it becomes an
+ * exception that Go can pick up.  Like the real thing it can't be
+ * caught, glue_runops() raises it again until the call returns to Go.
+ * This replaces pp_exit for every interpreter before any code is
+ * compiled, so modules loaded at startup get it too. */
+static OP *glue_pp_exit(pTHX) {
+    dSP;
+    dMY_CXT;
+    IV code = 0;
+    if(MAXARG >= 1) {
+        SV *sv = POPs;
+        if(sv)
+            code = SvIV(sv);
+    }
+    PUTBACK;
+    MY_CXT.exiting = TRUE;
+    MY_CXT.exit_code = code;
+    croak_sv(exit_sv(aTHX_ code));
+    return NORMAL;
+}
+
+/* the usual runops loop, with budget checks between ops */
+static int glue_runops(pTHX) {
+    dMY_CXT;
+    my_cxt_t *cxt = &MY_CXT;
+    OP *op = PL_op;
+
+    while((PL_op = op = op->op_ppaddr(aTHX))) {
+        /* eval {} is not allowed to swallow exit() either */
+        if(cxt->exiting)
+            croak_sv(exit_sv(aTHX_ cxt->exit_code));
+        if(!cxt->depth || !(cxt->max_ops || cxt->max_live))
+            continue;
+        cxt->ops++;
+        if(!cxt->tripped && cxt->max_ops && cxt->ops > cxt->max_ops)
+            cxt->tripped = 1;
+        if(!cxt->tripped && cxt->max_live && cxt->ops >= cxt->next_live) {
+            /* walking the arenas costs about as much as the number of
+             * SVs in them, so space the checks out to match */
+            IV live = count_live(aTHX);
+            if(live > cxt->max_live)
+                cxt->tripped = 2;
+            cxt->next_live = cxt->ops + (live > 1024 ? live : 1024);
+        }
+        /* keep raising until the call returns to Go, eval {} is not
+         * allowed to swallow this */
+        if(cxt->tripped)
+            croak_sv(sv_2mortal(sv_bless(newRV_noinc(newSViv(cxt->tripped)),
+                gv_stashpv("Go::Limit", GV_ADD))));
+    }
+    PERL_ASYNC_CHECK();
+    TAINT_NOT;
+    return 0;
+}
+
+/* budgets apply to the next outermost call from Go */
+void glue_budget(pTHX_ IV max_ops, IV max_live) {
+    dMY_CXT;
+    MY_CXT.max_ops = max_ops;
+    MY_CXT.max_live = max_live;
+}
+
+static void enter_call(pTHX) {
+    dMY_CXT;
+    if(MY_CXT.depth++ == 0) {
+        MY_CXT.ops = 0;
+        MY_CXT.next_live = 0;
+        MY_CXT.tripped = 0;
+        MY_CXT.exiting = FALSE;
+    }
+}
+
+static void leave_call(pTHX) {
+    dMY_CXT;
+    if(--MY_CXT.depth == 0) {
+        MY_CXT.tripped = 0;
+        MY_CXT.exiting = FALSE;
+    }
+}
+
+/* argv is held by the interpreter until glue_fini(), env and script
+ * may be NULL to leave the defaults in place.  If startup fails, NULL is
+ * returned with *errp set, or left NULL and *exitp set if it was exit()
+ * that stopped it. */
+tTHX glue_init(int argc, char **argv, char **env, char *script, char **errp, IV *exitp) {
     PerlInterpreter *my_perl;
+    PL_ppaddr[OP_EXIT] = glue_pp_exit;
     my_perl = perl_alloc();
     perl_construct(my_perl);
-    perl_parse(my_perl, xs_init, argc, argv, NULL);
+    {
+        MY_CXT_INIT;
+        MY_CXT.interrupt = 0;
+    }
+    /* clean up everything in perl_destruct() so Go hears about every
+     * value it has handed to Perl */
+    PL_perl_destruct_level = 1;
+    /* so eval {} at startup can't swallow exit() either */
+    PL_runops = glue_runops;
+    if(perl_parse(my_perl, xs_init, argc, argv, NULL)) {
+        dMY_CXT;
+        if(MY_CXT.exiting) {
+            /* this is the call boundary, END blocks may run again */
+            MY_CXT.exiting = FALSE;
+            *errp = NULL;
+            *exitp = MY_CXT.exit_code;
+        } else {
+            STRLEN len;
+            char *err = SvPV(ERRSV, len);
+            *errp = len ? strdup(err) : strdup("perl_parse() failed");
+        }
+        glue_fini(aTHX);
+        if(env) {
+            char **ent;
+            for(ent = env; *ent; ent++)
+                free(*ent);
+            free(env);
+        }
+        if(script)
+            free(script);
+        return NULL;
+    }
+    *errp = NULL;
     PL_exit_flags |= PERL_EXIT_DESTRUCT_END;
+    PL_signalhook = glue_sighook;
+    if(env)
+        glue_setEnv(aTHX_ env);
+    if(script) {
+        sv_setpv(get_sv("0", GV_ADD), script);
+        free(script);
+    }
     eval_pv(perl_runtime, TRUE);
     newXS("Go::Pxy::AUTOLOAD", glue_autoload, __FILE__);
     return my_perl;
 }
 
-void glue_fini(pTHX) {
-    perl_destruct(my_perl);
+/* runs END blocks and tears down the interpreter, returns the exit
+ * status reported by perl_destruct() */
+/* perl_clone() shares MY_CXT and the argv glue_fini() frees, so the
+ * clone gets its own.  Returns NULL if Perl was built without ithreads. */
+tTHX glue_clone(pTHX) {
+#ifdef USE_ITHREADS
+    PerlInterpreter *clone = perl_clone(my_perl, 0);
+    {
+        dTHXa(clone);
+        int i;
+        char **argv = malloc((PL_origargc + 1) * sizeof(char *));
+        for(i = 0; i < PL_origargc; i++)
+            argv[i] = strdup(PL_origargv[i]);
+        argv[i] = NULL;
+        PL_origargv = argv;
+        {
+            MY_CXT_CLONE;
+            MY_CXT.interrupt = 0;
+            MY_CXT.depth = 0;
+            MY_CXT.exiting = FALSE;
+        }
+    }
+    PERL_SET_CONTEXT(my_perl);
+    return clone;
+#else
+    return NULL;
+#endif
+}
+
+int glue_fini(pTHX) {
+    int i, rv;
+    int argc = PL_origargc;
+    char **argv = PL_origargv;
+    rv = perl_destruct(my_perl);
     perl_free(my_perl);
+    for(i = 0; i < argc; i++)
+        free(argv[i]);
+    free(argv);
+    return rv;
 }
 
-SV *glue_eval(pTHX_ char *text, SV **errp) {
+/* trusted code is compiled without the sandbox's op mask */
+SV *glue_eval(pTHX_ char *text, bool trusted, SV **errp) {
     SV *rv;
+    char *mask = PL_op_mask;
+    enter_call(aTHX);
     ENTER;
     SAVETMPS;
+    if(trusted && mask) {
+        /* Code run under the mask may have hooked require, do or @INC,
+         * none of that gets to run unmasked.  Sandbox.apply() loaded
+         * what trusted code requires, %INC finds it without @INC. */
+        GV *gv;
+        if((gv = gv_fetchpvs("CORE::GLOBAL::require", 0, SVt_PVCV)))
+            save_gp(gv, 1);
+        if((gv = gv_fetchpvs("CORE::GLOBAL::do", 0, SVt_PVCV)))
+            save_gp(gv, 1);
+        save_ary(PL_incgv);
+    }
+    if(trusted)
+        PL_op_mask = NULL;
     rv = eval_pv(text, FALSE);
+    PL_op_mask = mask;
     if(SvTRUE(ERRSV)) {
         *errp = newSVsv(ERRSV);
     } else {
@@ -140,6 +581,7 @@ SV *glue_eval(pTHX_ char *text, SV **errp) {
     SvREFCNT_inc(rv);
     FREETMPS;
     LEAVE;
+    leave_call(aTHX);
     free(text);
     return rv;
 }
@@ -158,6 +600,7 @@ SV *glue_call_sv(pTHX_ SV *sv, SV **arg, SV **ret, UV n) {
       default: flags = G_ARRAY; break;
     }
 
+    enter_call(aTHX);
     ENTER;
     SAVETMPS;
     PUSHMARK(SP);
@@ -184,6 +627,7 @@ SV *glue_call_sv(pTHX_ SV *sv, SV **arg, SV **ret, UV n) {
     PUTBACK;
     FREETMPS;
     LEAVE;
+    leave_call(aTHX);
     if(i < n)
         memset(ret + i, '\0', sizeof(SV *) * (n - i));
     return err;
@@ -193,6 +637,12 @@ void glue_inc(pTHX_ SV *sv) {
     SvREFCNT_inc(sv);
 }
 
+/* a new SV with the value of sv, a reference copies as a new reference
+ * to the same thing */
+SV *glue_copy(pTHX_ SV *sv) {
+    return newSVsv(sv);
+}
+
 void glue_dec(pTHX_ SV *sv) {
     /* Go might hand us a null ptr because we sometimes return a null in
      * place of ERRSV to mean no error occured. */
@@ -202,6 +652,10 @@ void glue_dec(pTHX_ SV *sv) {
 }
 
 IV glue_count_live(pTHX) {
+    return count_live(aTHX);
+}
+
+static IV count_live(pTHX) {
     /* Devel::Leak proved to be too expensive to run during scans, so
      * this lifts a bit of it's algorithm for something to give us
      * simple live variable allocation counts */
@@ -243,7 +697,20 @@ void glue_getPV(pTHX_ char **dst, STRLEN *len, SV *sv) {
     *dst = SvPV(sv, *len);
 }
 
-void glue_walkAV(pTHX_ SV *sv, UV data, bool bytes) {
+/* element i of the array sv refers to.  Tied and other magical arrays
+ * keep nothing in AvARRAY, their size comes from FETCHSIZE, so those go
+ * through av_fetch() and a mortal copy, which runs FETCH just once. */
+static inline SV *elemAV(pTHX_ SV *sv, IV i) {
+    AV *av = (AV *)SvRV(sv);
+    SV **elt;
+    if(SvRMAGICAL(av)) {
+        elt = av_fetch(av, i, 0);
+        return elt ? sv_mortalcopy(*elt) : &PL_sv_undef;
+    }
+    return AvARRAY(av)[i] ? AvARRAY(av)[i] : &PL_sv_undef;
+}
+
+void glue_walkAV(pTHX_ SV *sv, UV data) {
     SV **lst = NULL;
     I32 len = -1;
 
@@ -251,26 +718,164 @@ void glue_walkAV(pTHX_ SV *sv, UV data, bool bytes) {
     if(SvROK(sv)) {
         AV *av = (AV *)SvRV(sv);
         if(SvTYPE((SV *)av) == SVt_PVAV) {
-            lst = AvARRAY(av);
             len = 1 + av_top_index(av);
+            if(SvRMAGICAL(av)) {
+                /* a tied array has nothing in AvARRAY */
+                I32 i;
+                lst = (SV **)SvPVX(sv_2mortal(newSV(len * sizeof(SV *))));
+                for(i = 0; i < len; i++)
+                    lst[i] = elemAV(aTHX_ sv, i);
+            } else {
+                lst = AvARRAY(av);
+            }
         }
-    } else if(bytes && SvPOK(sv)) {
-        /* this is a special case for allowing strings to feed into
-         * []byte values.
-         * TODO: It would be nice to avoid all these temp SVs, but I
-         * guess it's no worse than [ split '', $s ]. */
-        STRLEN i, l;
-        const char *s = SvPV(sv, l);
-        lst = alloca(len * sizeof(SV *));
-        for(i = 0; i < l; i++) {
-            lst[i] = sv_2mortal(newSVuv(s[i]));
-        }
-        len = l;
     }
     goList(data, lst, len);
     FREETMPS;
 }
 
+/* what Go type best fits sv, strings win over numbers as in JSON::XS */
+int glue_svKind(pTHX_ SV *sv) {
+    if(!SvOK(sv))
+        return GLUE_UNDEF;
+    if(SvROK(sv)) {
+        if(SvOBJECT(SvRV(sv)))
+            return GLUE_REF;
+        switch(SvTYPE(SvRV(sv))) {
+          case SVt_PVAV: return GLUE_AV;
+          case SVt_PVHV: return GLUE_HV;
+          default: return GLUE_REF;
+        }
+    }
+#ifdef SvIsBOOL
+    if(SvIsBOOL(sv))
+        return GLUE_BOOL;
+#endif
+    if(SvPOKp(sv))
+        return GLUE_PV;
+    if(SvNOKp(sv))
+        return GLUE_NV;
+    if(SvIOKp(sv))
+        return SvIsUV(sv) ? GLUE_UV : GLUE_IV;
+    return GLUE_REF;
+}
+
+/* the type of what sv refers to, or -1 if it isn't a reference */
+IV glue_refType(pTHX_ SV *sv) {
+    return SvROK(sv) ? SvTYPE(SvRV(sv)) : -1;
+}
+
+/* the container rv refers to, NULL if it isn't that kind of ref */
+static AV *derefAV(pTHX_ SV *rv) {
+    return SvROK(rv) && SvTYPE(SvRV(rv)) == SVt_PVAV ? (AV *)SvRV(rv) : NULL;
+}
+
+static HV *derefHV(pTHX_ SV *rv) {
+    return SvROK(rv) && SvTYPE(SvRV(rv)) == SVt_PVHV ? (HV *)SvRV(rv) : NULL;
+}
+
+/* a new reference to what rv refers to, so handles hold their own */
+SV *glue_newRV(pTHX_ SV *rv) {
+    return newRV_inc(SvRV(rv));
+}
+
+/* element access for Array handles, NULL if rv isn't an array ref */
+SV *glue_fetchAV(pTHX_ SV *rv, IV i) {
+    AV *av = derefAV(aTHX_ rv);
+    SV **elt;
+    if(!av)
+        return NULL;
+    elt = av_fetch(av, i, 0);
+    return elt ? *elt : &PL_sv_undef;
+}
+
+/* takes ownership of val, false if rv isn't an array ref */
+bool glue_storeAV(pTHX_ SV *rv, IV i, SV *val) {
+    AV *av = derefAV(aTHX_ rv);
+    if(!av || !av_store(av, i, val))
+        SvREFCNT_dec(val);
+    return av != NULL;
+}
+
+/* takes ownership of the NULL terminated lst */
+bool glue_pushAV(pTHX_ SV *rv, SV **lst) {
+    AV *av = derefAV(aTHX_ rv);
+    while(*lst) {
+        if(av)
+            av_push(av, *lst++);
+        else
+            SvREFCNT_dec(*lst++);
+    }
+    return av != NULL;
+}
+
+/* returns the number of keys in the hash rv refers to, or -1 if it
+ * isn't a hash ref */
+IV glue_lenHV(pTHX_ SV *rv) {
+    HV *hv = derefHV(aTHX_ rv);
+    return hv ? HvUSEDKEYS(hv) : -1;
+}
+
+/* element access for Hash handles, NULL if rv isn't a hash ref.  A
+ * negative len marks the key as UTF-8, as for hv_fetch(). */
+SV *glue_fetchHV(pTHX_ SV *rv, char *key, I32 len) {
+    HV *hv = derefHV(aTHX_ rv);
+    SV **elt;
+    if(!hv)
+        return NULL;
+    elt = hv_fetch(hv, key, len, 0);
+    return elt ? *elt : &PL_sv_undef;
+}
+
+bool glue_existsHV(pTHX_ SV *rv, char *key, I32 len) {
+    HV *hv = derefHV(aTHX_ rv);
+    return hv && hv_exists(hv, key, len);
+}
+
+/* takes ownership of val, false if rv isn't a hash ref */
+bool glue_storeHV(pTHX_ SV *rv, char *key, I32 len, SV *val) {
+    HV *hv = derefHV(aTHX_ rv);
+    if(!hv || !hv_store(hv, key, len, val, 0))
+        SvREFCNT_dec(val);
+    return hv != NULL;
+}
+
+bool glue_deleteHV(pTHX_ SV *rv, char *key, I32 len) {
+    HV *hv = derefHV(aTHX_ rv);
+    if(hv)
+        hv_delete(hv, key, len, G_DISCARD);
+    return hv != NULL;
+}
+
+/* steps through a hash with its own iterator, as each() does */
+bool glue_iterinitHV(pTHX_ SV *rv) {
+    HV *hv = derefHV(aTHX_ rv);
+    if(hv)
+        hv_iterinit(hv);
+    return hv != NULL;
+}
+
+bool glue_iternextHV(pTHX_ SV *rv, char **key, STRLEN *len, SV **val) {
+    HV *hv = derefHV(aTHX_ rv);
+    HE *he = hv ? hv_iternext(hv) : NULL;
+    if(!he)
+        return FALSE;
+    /* Go wants UTF-8, upgrade any Latin-1 key */
+    *key = HePV(he, *len);
+    if(!HeUTF8(he) && !is_utf8_invariant_string((U8 *)*key, *len))
+        *key = SvPVutf8(sv_2mortal(newSVpvn(*key, *len)), *len);
+    *val = HeVAL(he);
+    return TRUE;
+}
+
+/* strings feed into []byte values directly, false if sv isn't one */
+bool glue_getPVB(pTHX_ SV *sv, char **dst, STRLEN *len) {
+    if(SvROK(sv) || !SvPOK(sv))
+        return FALSE;
+    *dst = SvPV(sv, *len);
+    return TRUE;
+}
+
 void glue_walkHV(pTHX_ SV *sv, UV data) {
     IV len = -1;
     SV **lst = NULL;
@@ -314,16 +919,21 @@ void glue_setNV(pTHX_ SV **ptr, NV v) {
     sv_setnv(*ptr, v);
 }
 
+void glue_setUndef(pTHX_ SV **ptr) {
+    if(!*ptr) *ptr = newSV(0);
+    else sv_setsv(*ptr, &PL_sv_undef);
+}
+
 void glue_setPV(pTHX_ SV **ptr, char *str, STRLEN len) {
     if(!*ptr) *ptr = newSV(len);
     sv_setpvn(*ptr, str, len);
     free(str);
 }
 
+/* unlike glue_setPV(), str belongs to the caller */
 void glue_setPVB(pTHX_ SV **ptr, void *str, STRLEN len) {
     if(!*ptr) *ptr = newSV(len);
-    sv_setpvn(*ptr, str, len);
-    free(str);
+    sv_setpvn(*ptr, len ? str : "", len);
 }
 
 static inline void setRV(pTHX_ SV **ptr, SV *elt) {
@@ -339,6 +949,85 @@ void glue_setAV(pTHX_ SV **ptr, SV **lst) {
     setRV(aTHX_ (SV **)ptr, (SV *)av);
 }
 
+/* bulk versions of glue_setAV(), a whole Go slice in one call */
+void glue_setAVIV(pTHX_ SV **ptr, IV *lst, IV n) {
+    AV *av = newAV();
+    IV i;
+    if(n > 0)
+        av_extend(av, n - 1);
+    for(i = 0; i < n; i++)
+        av_push(av, newSViv(lst[i]));
+    setRV(aTHX_ (SV **)ptr, (SV *)av);
+}
+
+void glue_setAVUV(pTHX_ SV **ptr, UV *lst, IV n) {
+    AV *av = newAV();
+    IV i;
+    if(n > 0)
+        av_extend(av, n - 1);
+    for(i = 0; i < n; i++)
+        av_push(av, newSVuv(lst[i]));
+    setRV(aTHX_ (SV **)ptr, (SV *)av);
+}
+
+void glue_setAVNV(pTHX_ SV **ptr, NV *lst, IV n) {
+    AV *av = newAV();
+    IV i;
+    if(n > 0)
+        av_extend(av, n - 1);
+    for(i = 0; i < n; i++)
+        av_push(av, newSVnv(lst[i]));
+    setRV(aTHX_ (SV **)ptr, (SV *)av);
+}
+
+/* the strings are packed end to end in buf */
+void glue_setAVPV(pTHX_ SV **ptr, char *buf, STRLEN *lens, IV n) {
+    AV *av = newAV();
+    IV i;
+    if(n > 0)
+        av_extend(av, n - 1);
+    for(i = 0; i < n; i++) {
+        av_push(av, newSVpvn(buf, lens[i]));
+        buf += lens[i];
+    }
+    setRV(aTHX_ (SV **)ptr, (SV *)av);
+}
+
+/* returns the length of the array sv refers to, or -1 if it isn't an
+ * array ref */
+IV glue_lenAV(pTHX_ SV *sv) {
+    if(SvROK(sv) && SvTYPE(SvRV(sv)) == SVt_PVAV)
+        return 1 + av_top_index((AV *)SvRV(sv));
+    return -1;
+}
+
+/* bulk versions of glue_walkAV(), n must come from glue_lenAV() */
+
+void glue_getAVIV(pTHX_ SV *sv, IV *lst, IV n) {
+    IV i;
+    for(i = 0; i < n; i++)
+        lst[i] = SvIV(elemAV(aTHX_ sv, i));
+}
+
+void glue_getAVUV(pTHX_ SV *sv, UV *lst, IV n) {
+    IV i;
+    for(i = 0; i < n; i++)
+        lst[i] = SvUV(elemAV(aTHX_ sv, i));
+}
+
+void glue_getAVNV(pTHX_ SV *sv, NV *lst, IV n) {
+    IV i;
+    for(i = 0; i < n; i++)
+        lst[i] = SvNV(elemAV(aTHX_ sv, i));
+}
+
+/* the pointers are into the SVs, good only until Perl runs again */
+void glue_getAVPV(pTHX_ SV *sv, char **lst, STRLEN *lens, IV n) {
+    IV i;
+    for(i = 0; i < n; i++)
+        lst[i] = SvPV(elemAV(aTHX_ sv, i), lens[i]);
+}
+
 void glue_setHV(pTHX_ SV **ptr, SV **lst) {
     HV *hv = newHV();
     while(*lst) {
@@ -354,17 +1043,34 @@ void glue_setHV(pTHX_ SV **ptr, SV **lst) {
 /* When Perl releases our CV we should notify Go */
 static int vtbl_cb_sv_free(pTHX_ SV *sv, MAGIC *mg) {
     UV id = (UV)mg->mg_ptr;
-    goReleaseCB(id);
+    goReleaseCB(my_perl, id);
+    return 0;
+}
+#ifdef USE_ITHREADS
+static int vtbl_cb_dup(pTHX_ MAGIC *mg, CLONE_PARAMS *param) {
+    goDupCB(param->proto_perl, (UV)mg->mg_ptr);
     return 0;
 }
-static MGVTBL vtbl_cb = { 0, 0, 0, 0, vtbl_cb_sv_free };
+#else
+#define vtbl_cb_dup 0
+#endif
+static MGVTBL vtbl_cb = { 0, 0, 0, 0, vtbl_cb_sv_free, 0, vtbl_cb_dup };
+
+/* the context a Go callback is running in: 0 void, 1 scalar, 2 list */
+int glue_gimme(pTHX) {
+    switch(GIMME_V) {
+      case G_VOID: return 0;
+      case G_SCALAR: return 1;
+      default: return 2;
+    }
+}
 
 /* XS stub for Go callbacks */
 XS(glue_invoke)
 {
     dXSARGS;
     MAGIC *mg;
-    SV **arg, **ret;
+    SV **arg, **ret, *err = NULL;
     int i;
 
     mg = mg_findext((SV *)cv, PERL_MAGIC_ext, &vtbl_cb);
@@ -377,25 +1083,57 @@ XS(glue_invoke)
     arg[i] = NULL;
 
     // rets must be mortalized on the way out
-    ret = (SV **)goInvoke(id, arg);
-    for(i = 0; ret[i]; i++)
-        ST(i) = sv_2mortal(ret[i]);
-    free(ret);
-    XSRETURN(i);
+    ret = (SV **)goInvoke(my_perl, id, arg, &err);
+    /* Go may have called into another interpreter on this thread */
+    glue_setContext(aTHX);
+    if(err)
+        rethrow(aTHX_ ret, err);
+    XSRETURN(retlist(aTHX_ ax, ret));
 }
 
 /* Tie a CV to glue_invoke() and stash the Go details */
 void glue_setCV(pTHX_ SV **ptr, UV id) {
     CV *cv = newXS(NULL, glue_invoke, __FILE__);
-    sv_magicext((SV *)cv, 0, PERL_MAGIC_ext, &vtbl_cb, (char *)id, 0);
+    MAGIC *mg = sv_magicext((SV *)cv, 0, PERL_MAGIC_ext, &vtbl_cb, (char *)id, 0);
+    mg->mg_flags |= MGf_DUP;
     setRV(aTHX_ (SV **)ptr, (SV *)cv);
 }
 
+/* A read-only string whose buffer is Go memory, pinned until Perl
+ * releases the SV.  With SvLEN at 0 Perl won't try to free it. */
+static int vtbl_view_sv_free(pTHX_ SV *sv, MAGIC *mg) {
+    goReleaseView((UV)mg->mg_ptr);
+    return 0;
+}
+#ifdef USE_ITHREADS
+static int vtbl_view_dup(pTHX_ MAGIC *mg, CLONE_PARAMS *param) {
+    goDupView((UV)mg->mg_ptr);
+    return 0;
+}
+#else
+#define vtbl_view_dup 0
+#endif
+static MGVTBL vtbl_view = { 0, 0, 0, 0, vtbl_view_sv_free, 0, vtbl_view_dup };
+
+void glue_setView(pTHX_ SV **ptr, char *buf, STRLEN len, UV id) {
+    SV *sv = newSV_type(SVt_PV);
+    MAGIC *mg;
+    SvPV_set(sv, buf);
+    SvCUR_set(sv, len);
+    SvLEN_set(sv, 0);
+    SvPOK_only(sv);
+    mg = sv_magicext(sv, 0, PERL_MAGIC_ext, &vtbl_view, (char *)id, 0);
+    mg->mg_flags |= MGf_DUP;
+    SvREADONLY_on(sv);
+    *ptr = sv;
+}
+
 void glue_setObj(pTHX_ SV **ptr, UV id, char *gotype, char **attrs) {
     /* this is going to be kind of long... */
     //dSP;
     HV *hv;
     SV *sv;
+    MAGIC *mg;
     glue_st_t st;
 
     SAVETMPS;
@@ -418,14 +1156,15 @@ void glue_setObj(pTHX_ SV **ptr, UV id, char *gotype, char **attrs) {
 
     st.st_id = id;
     st.st_fname = NULL;
-    sv_magicext(sv, 0, PERL_MAGIC_ext, &vtbl_st, (char *)&st, sizeof(st));
-    free(gotype);
+    mg = sv_magicext(sv, 0, PERL_MAGIC_ext, &vtbl_st, (char *)&st, sizeof(st));
+    mg->mg_flags |= MGf_DUP;
 
     while(*attrs) {
         /* fill in field stubs */
         SV *v = newSV(0);
-        st.st_fname = *attrs;
-        sv_magicext(v, 0, PERL_MAGIC_ext, &vtbl_stf, (char *)&st, sizeof(st));
+        st.st_fname = strdup(*attrs);
+        mg = sv_magicext(v, 0, PERL_MAGIC_ext, &vtbl_stf, (char *)&st, sizeof(st));
+        mg->mg_flags |= MGf_DUP;
         hv_store(hv, *attrs, 0 - strlen(*attrs), v, 0);
         // hv_store has taken ownership of v
         attrs++;
@@ -435,9 +1174,9 @@ void glue_setObj(pTHX_ SV **ptr, UV id, char *gotype, char **attrs) {
     FREETMPS;
 }
 
-bool glue_getId(pTHX_ SV *sv, UV *id, const char *kind) {
+bool glue_getId(pTHX_ SV *sv, UV *id, int kind) {
     MAGIC *mg;
-    if(strcmp(kind, "func") == 0) {
+    if(kind == GLUE_CB) {
         SV *cv = SvRV(sv);
         if(!SvMAGICAL(cv))
             return FALSE;
@@ -446,7 +1185,7 @@ bool glue_getId(pTHX_ SV *sv, UV *id, const char *kind) {
         *id = (UV)mg->mg_ptr;
         return TRUE;
     }
-    if(strcmp(kind, "struct") == 0) {
+    if(kind == GLUE_ST) {
         if(!SvMAGICAL(sv))
             return FALSE;
         if(!(mg = mg_findext(sv, PERL_MAGIC_ext, &vtbl_st)))
@@ -455,9 +1194,80 @@ bool glue_getId(pTHX_ SV *sv, UV *id, const char *kind) {
         *id = st->st_id;
         return TRUE;
     }
-    croak("Unsupported kind %s", kind);
+    croak("Unsupported kind %d", kind);
+}
+
+/* exceptions from the glue need special handling in Go */
+IV glue_errKind(pTHX_ SV *sv, IV *code) {
+    if(sv_isa(sv, "Go::Exit")) {
+        *code = SvIV(SvRV(sv));
+        return 1;
+    }
+    if(sv_isa(sv, "Go::Cancel"))
+        return 2;
+    if(sv_isa(sv, "Go::Limit")) {
+        *code = SvIV(SvRV(sv));
+        return 3;
+    }
+    return 0;
+}
+
+/* may be called from any thread while the interpreter is running */
+void glue_interrupt(pTHX_ IV delta) {
+    dMY_CXT;
+    if(__sync_add_and_fetch(&MY_CXT.interrupt, delta) > 0)
+        PL_sig_pending = 1;
+}
+
+/* an ExitError from a Go callback can't be caught either */
+void glue_setExit(pTHX_ SV **ptr, IV code) {
+    dMY_CXT;
+    SV *sv = newSViv(code);
+    MY_CXT.exiting = TRUE;
+    MY_CXT.exit_code = code;
+    if(!*ptr) *ptr = newSV(0);
+    sv_setsv(*ptr, sv_2mortal(newRV_noinc(sv)));
+    sv_bless(*ptr, gv_stashpv("Go::Exit", GV_ADD));
+}
+
+bool glue_isIO(pTHX_ SV *sv) {
+    if(SvROK(sv))
+        sv = SvRV(sv);
+    if(isGV_with_GP(sv))
+        return GvIO((GV *)sv) != NULL;
+    return SvTYPE(sv) == SVt_PVIO;
 }
 
 void glue_setContext(pTHX) {
-    PERL_SET_CONTEXT(my_perl);
+    if(PERL_GET_CONTEXT != my_perl)
+        PERL_SET_CONTEXT(my_perl);
+}
+
+/* identifies the OS thread a pinned PL runs on */
+UV glue_thread(void) {
+    return (UV)pthread_self();
+}
+
+/* waits for fd to become readable, or writable, returns 1 once it is,
+ * 0 if woken by wake becoming readable and -1 if fd can't be polled */
+int glue_poll(int fd, bool write, int wake) {
+    struct pollfd pfd[2];
+
+    pfd[0].fd = fd;
+    pfd[0].events = write ? POLLOUT : POLLIN;
+    pfd[1].fd = wake;
+    pfd[1].events = POLLIN;
+    for(;;) {
+        if(poll(pfd, 2, -1) < 0) {
+            if(errno == EINTR)
+                continue;
+            return -1;
+        }
+        if(pfd[1].revents)
+            return 0;
+        if(pfd[0].revents & POLLNVAL)
+            return -1;
+        if(pfd[0].revents)
+            return 1;
+    }
 }
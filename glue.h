@@ -3,15 +3,17 @@
 #include "EXTERN.h"
 #include "perl.h"
 
-tTHX glue_init();
+tTHX glue_init(int, char **, char **, char *, char **, IV *);
 
-void glue_fini(pTHX);
+tTHX glue_clone(pTHX);
+int glue_fini(pTHX);
 
-SV *glue_eval(pTHX_ char *, SV **);
+SV *glue_eval(pTHX_ char *, bool, SV **);
 SV *glue_call_sv(pTHX_ SV *, SV **, SV **, UV);
 
 void glue_inc(pTHX_ SV *);
 void glue_dec(pTHX_ SV *);
+SV *glue_copy(pTHX_ SV *);
 
 IV glue_count_live(pTHX);
 SV **glue_alloc(IV);
@@ -23,18 +25,64 @@ void glue_getUV(pTHX_ UV *, SV *);
 void glue_getNV(pTHX_ NV *, SV *);
 void glue_getPV(pTHX_ char **, STRLEN *, SV *);
 
-void glue_walkAV(pTHX_ SV *, UV, bool);
+void glue_walkAV(pTHX_ SV *, UV);
+bool glue_getPVB(pTHX_ SV *, char **, STRLEN *);
+/* kinds of SV glue_svKind() reports */
+#define GLUE_UNDEF 0
+#define GLUE_BOOL 1
+#define GLUE_IV 2
+#define GLUE_UV 3
+#define GLUE_NV 4
+#define GLUE_PV 5
+#define GLUE_AV 6
+#define GLUE_HV 7
+#define GLUE_REF 8
+int glue_svKind(pTHX_ SV *);
+IV glue_refType(pTHX_ SV *);
+SV *glue_newRV(pTHX_ SV *);
+SV *glue_fetchAV(pTHX_ SV *, IV);
+bool glue_storeAV(pTHX_ SV *, IV, SV *);
+bool glue_pushAV(pTHX_ SV *, SV **);
+IV glue_lenHV(pTHX_ SV *);
+SV *glue_fetchHV(pTHX_ SV *, char *, I32);
+bool glue_existsHV(pTHX_ SV *, char *, I32);
+bool glue_storeHV(pTHX_ SV *, char *, I32, SV *);
+bool glue_deleteHV(pTHX_ SV *, char *, I32);
+bool glue_iterinitHV(pTHX_ SV *);
+bool glue_iternextHV(pTHX_ SV *, char **, STRLEN *, SV **);
 void glue_walkHV(pTHX_ SV *, UV);
 
 void glue_setBool(pTHX_ SV **, bool);
 void glue_setIV(pTHX_ SV **, IV);
 void glue_setUV(pTHX_ SV **, UV);
 void glue_setNV(pTHX_ SV **, NV);
+void glue_setUndef(pTHX_ SV **);
 void glue_setPV(pTHX_ SV **, char *, STRLEN);
 void glue_setPVB(pTHX_ SV **, void *, STRLEN);
 void glue_setAV(pTHX_ SV **, SV **);
 void glue_setHV(pTHX_ SV **, SV **);
+void glue_setAVIV(pTHX_ SV **, IV *, IV);
+void glue_setAVUV(pTHX_ SV **, UV *, IV);
+void glue_setAVNV(pTHX_ SV **, NV *, IV);
+void glue_setAVPV(pTHX_ SV **, char *, STRLEN *, IV);
+IV glue_lenAV(pTHX_ SV *);
+void glue_getAVIV(pTHX_ SV *, IV *, IV);
+void glue_getAVUV(pTHX_ SV *, UV *, IV);
+void glue_getAVNV(pTHX_ SV *, NV *, IV);
+void glue_getAVPV(pTHX_ SV *, char **, STRLEN *, IV);
 void glue_setCV(pTHX_ SV **, UV);
+void glue_setView(pTHX_ SV **, char *, STRLEN, UV);
 void glue_setObj(pTHX_ SV **, UV, char *, char **);
-bool glue_getId(pTHX_ SV *, UV *, const char *);
+/* kinds of Go value glue_getId() looks for */
+#define GLUE_CB 0
+#define GLUE_ST 1
+bool glue_getId(pTHX_ SV *, UV *, int);
+bool glue_isIO(pTHX_ SV *);
+IV glue_errKind(pTHX_ SV *, IV *);
+void glue_interrupt(pTHX_ IV);
+void glue_budget(pTHX_ IV, IV);
+void glue_setExit(pTHX_ SV **, IV);
 void glue_setContext(pTHX);
+int glue_gimme(pTHX);
+UV glue_thread(void);
+int glue_poll(int, bool, int);
@@ -0,0 +1,280 @@
+package plgo
+
+// #include "glue.h"
+import "C"
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"reflect"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// Array is a handle on a Perl array, filled in from an array ref.
+// Unlike a slice it only converts the elements asked for, so Go can
+// pick through a large structure cheaply.  Indexes count from the end
+// when negative, as in Perl.
+type Array struct {
+	sv *sV
+}
+
+// Hash is a handle on a Perl hash, filled in from a hash ref.  Unlike a
+// map it only converts the entries asked for.
+type Hash struct {
+	sv *sV
+}
+
+var (
+	arrayType = reflect.TypeOf((*Array)(nil))
+	hashType  = reflect.TypeOf((*Hash)(nil))
+)
+
+var (
+	errNotArray = errors.New("handle does not refer to an array")
+	errNotHash  = errors.New("handle does not refer to a hash")
+)
+
+// do runs f with the PL held, errors passed to errf are returned.
+func (sv *sV) do(f func(pl *PL, errf errFunc)) error {
+	return sv.pl.do(f)
+}
+
+func (pl *PL) do(f func(pl *PL, errf errFunc)) (err error) {
+	errf := func(ev error) bool {
+		if err == nil {
+			err = ev
+		}
+		return true
+	}
+	pl.exec(func() {
+		if !pl.acquire() {
+			err = ErrClosed
+			return
+		}
+		defer pl.leave()
+		f(pl, errf)
+	})
+	return
+}
+
+// encodeAny converts val, which may be nil, to a new SV
+func (pl *PL) encodeAny(val interface{}, errf errFunc) *C.SV {
+	var sv *C.SV
+	if !pl.encode(&sv, reflect.ValueOf(&val).Elem(), errf) {
+		return nil
+	}
+	return sv
+}
+
+// cKey points C at the bytes of key, which C must not keep.  The
+// length is negated for a non-ASCII UTF-8 key, so Perl finds it under
+// the same characters whichever way the hash stored them.
+func cKey(key string) (*C.char, C.I32) {
+	if key == "" {
+		return emptyKey, 0
+	}
+	n := C.I32(len(key))
+	if !isASCII(key) && utf8.ValidString(key) {
+		n = -n
+	}
+	return (*C.char)(unsafe.Pointer(unsafe.StringData(key))), n
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+var emptyKey = C.CString("")
+
+// Len is the number of elements, as scalar(@array).
+func (a *Array) Len() (n int) {
+	a.sv.do(func(pl *PL, errf errFunc) {
+		n = max(0, int(C.glue_lenAV(pl.thx, a.sv.sv)))
+	})
+	return
+}
+
+// Index converts element i into what ptr points to, as Eval() would.
+// Elements past the end are undef.
+func (a *Array) Index(i int, ptr interface{}) error {
+	dst := ptrValues([]interface{}{ptr})[0]
+	return a.sv.do(func(pl *PL, errf errFunc) {
+		if sv := C.glue_fetchAV(pl.thx, a.sv.sv, C.IV(i)); sv != nil {
+			pl.decode(&dst, sv, errf)
+		} else {
+			errf(errNotArray)
+		}
+	})
+}
+
+// Set stores val as element i, growing the array if need be.
+func (a *Array) Set(i int, val interface{}) error {
+	return a.sv.do(func(pl *PL, errf errFunc) {
+		sv := pl.encodeAny(val, errf)
+		if sv != nil && !C.glue_storeAV(pl.thx, a.sv.sv, C.IV(i), sv) {
+			errf(errNotArray)
+		}
+	})
+}
+
+// Push appends vals to the array.
+func (a *Array) Push(vals ...interface{}) error {
+	return a.sv.do(func(pl *PL, errf errFunc) {
+		lst := make([]*C.SV, 1+len(vals))
+		for i, val := range vals {
+			if lst[i] = pl.encodeAny(val, errf); lst[i] == nil {
+				for _, sv := range lst[:i] {
+					C.glue_dec(pl.thx, sv)
+				}
+				return
+			}
+		}
+		if !C.glue_pushAV(pl.thx, a.sv.sv, &lst[0]) {
+			errf(errNotArray)
+		}
+	})
+}
+
+// All ranges over the elements in order.  The PL is held for the whole
+// loop, the loop body may still call into it from this goroutine.
+func (a *Array) All() iter.Seq2[int, *Value] {
+	return func(yield func(int, *Value) bool) {
+		a.sv.do(func(pl *PL, errf errFunc) {
+			for i := 0; i < int(C.glue_lenAV(pl.thx, a.sv.sv)); i++ {
+				sv := C.glue_fetchAV(pl.thx, a.sv.sv, C.IV(i))
+				if sv == nil || !yield(i, &Value{pl.wrap(sv, true)}) {
+					return
+				}
+			}
+		})
+	}
+}
+
+// Len is the number of keys, as scalar(keys %hash).
+func (h *Hash) Len() (n int) {
+	h.sv.do(func(pl *PL, errf errFunc) {
+		n = max(0, int(C.glue_lenHV(pl.thx, h.sv.sv)))
+	})
+	return
+}
+
+// Get converts the value under key into what ptr points to, as Eval()
+// would.  Missing keys are undef.
+func (h *Hash) Get(key string, ptr interface{}) error {
+	dst := ptrValues([]interface{}{ptr})[0]
+	return h.sv.do(func(pl *PL, errf errFunc) {
+		k, n := cKey(key)
+		if sv := C.glue_fetchHV(pl.thx, h.sv.sv, k, n); sv != nil {
+			pl.decode(&dst, sv, errf)
+		} else {
+			errf(errNotHash)
+		}
+	})
+}
+
+// Exists reports if the hash has key.
+func (h *Hash) Exists(key string) (ok bool) {
+	h.sv.do(func(pl *PL, errf errFunc) {
+		k, n := cKey(key)
+		ok = bool(C.glue_existsHV(pl.thx, h.sv.sv, k, n))
+	})
+	return
+}
+
+// Keys lists the keys, in Perl's order.
+func (h *Hash) Keys() (keys []string) {
+	h.sv.do(func(pl *PL, errf errFunc) {
+		keys = make([]string, 0, max(0, int(C.glue_lenHV(pl.thx, h.sv.sv))))
+		h.each(pl, func(key string, _ *C.SV) bool {
+			keys = append(keys, key)
+			return true
+		})
+	})
+	return
+}
+
+// Set stores val under key.
+func (h *Hash) Set(key string, val interface{}) error {
+	return h.sv.do(func(pl *PL, errf errFunc) {
+		if sv := pl.encodeAny(val, errf); sv != nil {
+			k, n := cKey(key)
+			if !C.glue_storeHV(pl.thx, h.sv.sv, k, n, sv) {
+				errf(errNotHash)
+			}
+		}
+	})
+}
+
+// Delete removes key from the hash.
+func (h *Hash) Delete(key string) error {
+	return h.sv.do(func(pl *PL, errf errFunc) {
+		k, n := cKey(key)
+		if !C.glue_deleteHV(pl.thx, h.sv.sv, k, n) {
+			errf(errNotHash)
+		}
+	})
+}
+
+// All ranges over the entries in Perl's order.  The PL is held for the
+// whole loop, the loop body may still call into it from this goroutine
+// but, as with each(), should not add keys or start another pass over
+// the same hash.
+func (h *Hash) All() iter.Seq2[string, *Value] {
+	return func(yield func(string, *Value) bool) {
+		h.sv.do(func(pl *PL, errf errFunc) {
+			h.each(pl, func(key string, sv *C.SV) bool {
+				return yield(key, &Value{pl.wrap(sv, true)})
+			})
+		})
+	}
+}
+
+// each steps through the hash until f returns false, the PL must be
+// entered.
+func (h *Hash) each(pl *PL, f func(string, *C.SV) bool) {
+	var key *C.char
+	var n C.STRLEN
+	var sv *C.SV
+	if !C.glue_iterinitHV(pl.thx, h.sv.sv) {
+		return
+	}
+	for C.glue_iternextHV(pl.thx, h.sv.sv, &key, &n, &sv) {
+		if !f(C.GoStringN(key, C.int(n)), sv) {
+			return
+		}
+	}
+}
+
+// ownRV wraps a reference of the handle's own to what src refers to,
+// so assigning to src, e.g. an aliased $_[0], leaves the handle be.
+func (pl *PL) ownRV(src *C.SV) *sV {
+	rv := C.glue_newRV(pl.thx, src)
+	defer C.glue_dec(pl.thx, rv)
+	return pl.wrap(rv, true)
+}
+
+// decHandle fills in an *Array or *Hash, checking src refers to the
+// right kind of container.
+func decHandle(t reflect.Type) func(*PL, *reflect.Value, *C.SV, errFunc) bool {
+	return func(pl *PL, dst *reflect.Value, src *C.SV, errf errFunc) bool {
+		if t == arrayType && C.glue_lenAV(pl.thx, src) >= 0 {
+			dst.Set(reflect.ValueOf(&Array{pl.ownRV(src)}))
+			return true
+		}
+		if t == hashType && C.glue_lenHV(pl.thx, src) >= 0 {
+			dst.Set(reflect.ValueOf(&Hash{pl.ownRV(src)}))
+			return true
+		}
+		err := fmt.Errorf("unable to convert SV to %s", t.Elem().Name())
+		if errf(err) {
+			return false
+		}
+		panic(err)
+	}
+}
@@ -0,0 +1,159 @@
+package plgo_test
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/tlby/plgo"
+)
+
+func TestArray(t *testing.T) {
+	pl := plgo.New()
+	defer pl.Close()
+
+	var a *plgo.Array
+	pl.Eval(`our @big = map { { Id => $_ } } 0 .. 9999; \@big`, &a)
+	if n := a.Len(); n != 10000 {
+		t.Errorf("Len() => %v", n)
+	}
+	var elt struct{ Id int }
+	if err := a.Index(-1, &elt); err != nil || elt.Id != 9999 {
+		t.Errorf("Index(-1) => %+v, %v", elt, err)
+	}
+	var s string
+	if err := a.Index(20000, &s); err != nil || s != "" {
+		t.Errorf("Index(20000) => %q, %v", s, err)
+	}
+
+	// only the elements visited are converted, and the loop body may
+	// call into Perl
+	var id func(*plgo.Value) int
+	pl.Eval(`sub { $_[0]{Id} }`, &id)
+	sum := 0
+	for i, v := range a.All() {
+		if i == 5 {
+			break
+		}
+		sum += id(v)
+	}
+	if sum != 0+1+2+3+4 {
+		t.Errorf("sum => %v", sum)
+	}
+
+	a.Set(0, "zero")
+	a.Push(1.5, nil, []int{7})
+	var last []int
+	var n int
+	pl.Eval(`$big[0], scalar @big, $big[-1]`, &s, &n, &last)
+	if s != "zero" || n != 10003 || !reflect.DeepEqual(last, []int{7}) {
+		t.Errorf("after Set/Push: %q, %v, %v", s, n, last)
+	}
+
+	var err error
+	pl.Eval(`+{}`, &a, &err)
+	if err == nil {
+		t.Errorf("a hash ref into *Array should fail")
+	}
+	// a handle from a callback arg outlives changes to the arg
+	var keep func(func(*plgo.Array, *plgo.Hash))
+	pl.Eval(`sub { my($x, $y) = ([ 1, 2 ], { k => 3 }); $_[0]->($x, $y); ($x, $y) = (5, 6); return }`, &keep)
+	var kh *plgo.Hash
+	keep(func(x *plgo.Array, y *plgo.Hash) { a, kh = x, y })
+	if err := a.Index(1, &n); err != nil || n != 2 {
+		t.Errorf("Index(1) => %v, %v", n, err)
+	}
+	if err := kh.Get("k", &n); err != nil || n != 3 {
+		t.Errorf("Get(k) => %v, %v", n, err)
+	}
+
+	// handed back to Perl it is the same array
+	var count func(*plgo.Array) int
+	pl.Eval(`sub { scalar @{ $_[0] } }`, &count)
+	pl.Eval(`\our @big`, &a)
+	if n := count(a); n != 10003 {
+		t.Errorf("count() => %v", n)
+	}
+	// but not the same SV, assigning to $_[0] leaves the handle be
+	var clobber func(*plgo.Array)
+	pl.Eval(`sub { $_[0] = 7; return }`, &clobber)
+	clobber(a)
+	if n := a.Len(); n != 10003 {
+		t.Errorf("Len() after clobber => %v", n)
+	}
+}
+
+func TestHash(t *testing.T) {
+	pl := plgo.New()
+	defer pl.Close()
+
+	var h *plgo.Hash
+	pl.Eval(`our %h = (a => 1, b => [ 2, 3 ], c => { d => 4 }); \%h`, &h)
+	if n := h.Len(); n != 3 {
+		t.Errorf("Len() => %v", n)
+	}
+	var b []int
+	if err := h.Get("b", &b); err != nil || !reflect.DeepEqual(b, []int{2, 3}) {
+		t.Errorf("Get(b) => %v, %v", b, err)
+	}
+	var c *plgo.Hash
+	h.Get("c", &c)
+	var d int
+	c.Get("d", &d)
+	if d != 4 {
+		t.Errorf("Get(c)->Get(d) => %v", d)
+	}
+	if !h.Exists("a") || h.Exists("z") {
+		t.Errorf("Exists() is wrong")
+	}
+	keys := h.Keys()
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"a", "b", "c"}) {
+		t.Errorf("Keys() => %q", keys)
+	}
+	seen := map[string]bool{}
+	for k, v := range h.All() {
+		seen[k] = true
+		if k == "a" {
+			v.Bytes(func(buf []byte) {
+				if string(buf) != "1" {
+					t.Errorf("All() a => %q", buf)
+				}
+			})
+		}
+	}
+	if len(seen) != 3 {
+		t.Errorf("All() saw %v", seen)
+	}
+
+	// non-ASCII keys, Perl keeps "é" as Latin-1 and "日本" as UTF-8
+	var u *plgo.Hash
+	pl.Eval(`use utf8; +{ "é" => 1, "日本" => 2 }`, &u)
+	keys = u.Keys()
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"é", "日本"}) {
+		t.Errorf("Keys() => %q", keys)
+	}
+	for i, k := range keys {
+		var n int
+		if err := u.Get(k, &n); err != nil || n != i+1 || !u.Exists(k) {
+			t.Errorf("Get(%q) => %v, %v", k, n, err)
+		}
+	}
+	u.Set("ü", 3)
+	u.Delete("日本")
+	var look func(*plgo.Hash) (int, bool)
+	pl.Eval(`sub { $_[0]{"\x{fc}"}, exists $_[0]{"\x{65e5}\x{672c}"} }`, &look)
+	if n, ok := look(u); n != 3 || ok {
+		t.Errorf("after Set/Delete: %v, %v", n, ok)
+	}
+
+	h.Set("", "empty")
+	h.Delete("a")
+	var e string
+	var exists bool
+	pl.Eval(`$h{""}, exists $h{a}`, &e, &exists)
+	if e != "empty" || exists {
+		t.Errorf("after Set/Delete: %q, %v", e, exists)
+	}
+}
@@ -0,0 +1,169 @@
+package plgo
+
+// #include "glue.h"
+import "C"
+import (
+	"fmt"
+	"iter"
+	"reflect"
+)
+
+// Seq ranges over src, which may be a Perl iterator sub, an array ref or
+// a hash ref.  A sub is called with no arguments until it returns an
+// empty list or undef, an array yields its elements and a hash its keys.
+// Values are converted to T as Eval() would, and since there is no
+// error to fill in, a failed conversion or a die from Perl panics.
+func Seq[T any](src *Value) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		var next func(*Value) (bool, T)
+		switch src.refType(&next) {
+		case C.SVt_PVCV:
+			for {
+				ok, v := next(src)
+				if !ok || !yield(v) {
+					return
+				}
+			}
+		case C.SVt_PVAV:
+			a := &Array{src.sv}
+			for i := 0; i < a.Len(); i++ {
+				var v T
+				if err := a.Index(i, &v); err != nil {
+					panic(err)
+				}
+				if !yield(v) {
+					return
+				}
+			}
+		case C.SVt_PVHV:
+			for k := range (&Hash{src.sv}).All() {
+				var v T
+				if !yield(decKey(src.sv.pl, k, &v)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Seq2 is Seq() for pairs.  A sub returns a key and value each call, an
+// array yields its indexes and elements, and a hash its entries.
+func Seq2[K, V any](src *Value) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		var next func(*Value) (bool, K, V)
+		switch src.refType(&next) {
+		case C.SVt_PVCV:
+			for {
+				ok, k, v := next(src)
+				if !ok || !yield(k, v) {
+					return
+				}
+			}
+		case C.SVt_PVAV:
+			for i, e := range (&Array{src.sv}).All() {
+				var k K
+				var v V
+				if !yield(decKey(src.sv.pl, i, &k), decAs(e, &v)) {
+					return
+				}
+			}
+		case C.SVt_PVHV:
+			for key, e := range (&Hash{src.sv}).All() {
+				var k K
+				var v V
+				if !yield(decKey(src.sv.pl, key, &k), decAs(e, &v)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// refType checks what src refers to, panicking if it can't be ranged
+// over.  For a sub, next is bound to a helper that calls it once and
+// returns true and its results, or false when it is done.
+func (v *Value) refType(next interface{}) (t C.IV) {
+	err := v.sv.do(func(pl *PL, errf errFunc) {
+		switch t = C.glue_refType(pl.thx, v.sv.sv); t {
+		case C.SVt_PVAV, C.SVt_PVHV:
+		case C.SVt_PVCV:
+			if pl.iterNext == nil {
+				pl.evalTrusted(`sub { my @r = $_[0]->(); @r && defined $r[0] ? (1, @r[0, 1]) : (0, undef, undef) }`, &pl.iterNext)
+			}
+			dst := reflect.ValueOf(next).Elem()
+			pl.decode(&dst, pl.iterNext.sv, errf)
+		default:
+			errf(fmt.Errorf("unable to range over SV"))
+		}
+	})
+	if err != nil {
+		panic(err)
+	}
+	return
+}
+
+// decAs converts v into what ptr points to and returns it, panicking on
+// failure.
+func decAs[T any](v *Value, ptr *T) T {
+	err := v.sv.do(func(pl *PL, errf errFunc) {
+		dst := reflect.ValueOf(ptr).Elem()
+		pl.decode(&dst, v.sv.sv, errf)
+	})
+	if err != nil {
+		panic(err)
+	}
+	return *ptr
+}
+
+// decKey converts an array index or hash key into what ptr points to and
+// returns it, going through a Perl scalar so the usual conversions
+// apply.  It panics on failure.
+func decKey[K, T any](pl *PL, key K, ptr *T) T {
+	err := pl.do(func(pl *PL, errf errFunc) {
+		var sv *C.SV
+		if !pl.encode(&sv, reflect.ValueOf(key), errf) {
+			return
+		}
+		defer C.glue_dec(pl.thx, sv)
+		dst := reflect.ValueOf(ptr).Elem()
+		pl.decode(&dst, sv, errf)
+	})
+	if err != nil {
+		panic(err)
+	}
+	return *ptr
+}
+
+// Iter adapts seq to a pair of Perl subs, as iter.Pull() does for Go.
+// Each call of next returns the next value, then undef once seq is done.
+// seq is stepped with iter.Pull(), started by the first call, so it runs
+// on the PL's thread and may call back into the PL.  If Perl is done
+// with next before seq is, it should call stop so seq can finish and let
+// go of what it holds.  A coroutine must be resumed from where it was
+// started, so stop is for Perl to call too, like next.
+func Iter[T any](seq iter.Seq[T]) (next func() interface{}, stop func()) {
+	var pull func() (T, bool)
+	var end func()
+	over := false
+	next = func() interface{} {
+		if over {
+			return nil
+		}
+		if pull == nil {
+			pull, end = iter.Pull(seq)
+		}
+		v, ok := pull()
+		if !ok {
+			over = true
+			return nil
+		}
+		return v
+	}
+	stop = func() {
+		over = true
+		if end != nil {
+			end()
+		}
+	}
+	return
+}
@@ -0,0 +1,135 @@
+package plgo_test
+
+import (
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tlby/plgo"
+)
+
+func TestIter(t *testing.T) {
+	pl := plgo.New()
+	defer pl.Close()
+
+	// a closure, stopping on undef or an empty list
+	var it, pairs *plgo.Value
+	pl.Eval(`my $n = 0; sub { $n < 3 ? ++$n : undef }`, &it)
+	if v := slices.Collect(plgo.Seq[int](it)); !slices.Equal(v, []int{1, 2, 3}) {
+		t.Errorf("Seq(sub) => %v", v)
+	}
+	pl.Eval(`my @q = qw(a 1 b 2); sub { splice @q, 0, 2 }`, &pairs)
+	var got []string
+	for k, v := range plgo.Seq2[string, int](pairs) {
+		got = append(got, k+"="+strings.Repeat("*", v))
+	}
+	if strings.Join(got, " ") != "a=* b=**" {
+		t.Errorf("Seq2(sub) => %q", got)
+	}
+
+	// breaking out early leaves the rest for later
+	pl.Eval(`my $n = 0; sub { $n++ }`, &it)
+	for v := range plgo.Seq[int](it) {
+		if v == 4 {
+			break
+		}
+	}
+	n := 0
+	for v := range plgo.Seq[int](it) {
+		n = v
+		break
+	}
+	if n != 5 {
+		t.Errorf("resumed at %d", n)
+	}
+
+	// arrays and hashes
+	var av, hv *plgo.Value
+	pl.Eval(`[ 3, 4, 5 ]`, &av)
+	pl.Eval(`+{ x => 1, y => 2 }`, &hv)
+	if v := slices.Collect(plgo.Seq[float64](av)); !slices.Equal(v, []float64{3, 4, 5}) {
+		t.Errorf("Seq(array) => %v", v)
+	}
+	sum := 0
+	for i, v := range plgo.Seq2[string, int](av) {
+		sum += len(i) * v
+	}
+	if sum != 12 {
+		t.Errorf("Seq2(array) => %d", sum)
+	}
+	keys := slices.Collect(plgo.Seq[string](hv))
+	sort.Strings(keys)
+	if !slices.Equal(keys, []string{"x", "y"}) {
+		t.Errorf("Seq(hash) => %v", keys)
+	}
+	m := map[string]int{}
+	for k, v := range plgo.Seq2[string, int](hv) {
+		m[k] = v
+	}
+	if len(m) != 2 || m["x"] != 1 || m["y"] != 2 {
+		t.Errorf("Seq2(hash) => %v", m)
+	}
+
+	// other values can't be ranged over
+	var sv *plgo.Value
+	pl.Eval(`"abc"`, &sv)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Seq(string) should panic")
+			}
+		}()
+		for range plgo.Seq[int](sv) {
+		}
+	}()
+
+	// a Go iterator handed to Perl
+	var drain func(func() interface{}, func()) string
+	pl.Eval(`sub { my $it = shift; my @r; while (defined(my $v = $it->())) { push @r, $v } join ",", @r }`, &drain)
+	if v := drain(plgo.Iter(slices.Values([]string{"p", "q", "r"}))); v != "p,q,r" {
+		t.Errorf("drain() => %q", v)
+	}
+	// the seq may call back into the PL
+	if v := drain(plgo.Iter(plgo.Seq[string](av))); v != "3,4,5" {
+		t.Errorf("drain(Seq) => %q", v)
+	}
+
+	// stopped early, the seq finishes and lets go of what it holds
+	var first func(func() interface{}, func()) int
+	pl.Eval(`sub { my $v = $_[0]->(); $_[1]->(); $_[1]->(); defined $_[0]->() ? -1 : $v }`, &first)
+	done := 0
+	for i := 0; i < 100; i++ {
+		seq := func(yield func(int) bool) {
+			defer func() { done++ }()
+			for _, v := range []int{3, 4} {
+				if !yield(v) {
+					return
+				}
+			}
+		}
+		if v := first(plgo.Iter(seq)); v != 3 {
+			t.Errorf("first() => %d", v)
+		}
+	}
+	if done != 100 {
+		t.Errorf("%d of 100 seqs finished", done)
+	}
+	var obj *plgo.Value
+	pl.Eval(`our $freed = 0; sub Obj::DESTROY { $freed++ } bless [ 7, 8 ], "Obj"`, &obj)
+	if v := first(plgo.Iter(plgo.Seq[int](obj))); v != 7 {
+		t.Errorf("first(obj) => %d", v)
+	}
+	obj = nil
+	freed := 0
+	for i := 0; i < 100 && freed == 0; i++ {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+		pl.Eval(`our $freed`, &freed)
+	}
+	if freed != 1 {
+		t.Errorf("the seq's array was not freed")
+	}
+}
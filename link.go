@@ -10,20 +10,61 @@ package plgo
 */
 import "C"
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os/exec"
 	"reflect"
+	"regexp"
 	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"unsafe"
+	"weak"
 )
 
 // PL holds a Perl runtime
 type PL struct {
-	thx        *C.PerlInterpreter
-	cx         chan bool
-	Preamble   string // prepended to any plgo.Eval() call
+	thx      *C.PerlInterpreter
+	cx       chan bool
+	closing  int32           // set once Close() begins
+	ctx      context.Context // of the active call into Perl
+	Preamble string          // prepended to any plgo.Eval() call
+	// If set, the outermost call into Perl fails with a LimitError
+	// once it executes more than MaxOps ops, or the interpreter holds
+	// more than MaxLive SVs, see Live().  Live SVs are only counted
+	// now and again, so the limit may be briefly overshot.
+	MaxOps     int
+	MaxLive    int
+	budget     [2]int // MaxOps and MaxLive as last given to Perl
 	newSVcmplx func(float64, float64) *sV
 	valSVcmplx func(*sV) (float64, float64)
+	newSVfh    func(func(int) (string, string), func(string) (int, string), func() string) *sV
+	fhRead     func(*sV, int) (string, error)
+	fhWrite    func(*sV, string) (int, error)
+	fhClose    func(*sV) error
+	exe        *executor // if the PL is pinned to a thread
+	owner      uint64    // thread of the goroutine holding cx
+	depth      int       // of enter() calls by the owner
+	posts      []post
+	listCall   *sV // calls a sub and returns its results in an array
+	iterNext   *sV // calls an iterator sub once, for Seq()
+	nameCall   *sV // calls a sub by name, for Call()
+	loop       *loop
+	postMX     sync.Mutex
+	// We can not reliably hold pointers to Go objects in C
+	// https://github.com/golang/go/issues/12416 documents the rules.
+	// runtime.GC() can move objects in memory so we have to create an
+	// indirection layer.  The live maps will serve this purpose.
+	liveCBSeq uint
+	liveCB    map[uint]*liveCBEnt
+	liveSTSeq uint
+	liveST    map[uint]*liveSTEnt
+	liveMX    sync.RWMutex
+	cloning   *PL // the PL being made while Clone() runs
 }
 
 type sV struct {
@@ -34,45 +75,498 @@ type sV struct {
 
 type errFunc func(error) bool
 
+// A clone of an interpreter has a copy of its registry, so the PL
+// making the call is passed in.
 type liveSTEnt struct {
 	live int
-	getf func(*C.char) *C.SV
-	setf func(*C.char, *C.SV)
-	call func(*C.char, **C.SV) **C.SV
+	getf func(*PL, *C.char) *C.SV
+	setf func(*PL, *C.char, *C.SV)
+	call func(*PL, *C.char, **C.SV, **C.SV) **C.SV
 	src  reflect.Value
 }
 
 type liveCBEnt struct {
-	call func(**C.SV) **C.SV
+	live int
+	call func(*PL, **C.SV, **C.SV) **C.SV
 	orig reflect.Value
 }
 
-// We can not reliably hold pointers to Go objects in C
-// https://github.com/golang/go/issues/12416 documents the rules.
-// runtime.GC() can move objects in memory so we have to create an
-// indirection layer.  The live maps will serve this purpose.
-var (
-	liveCBSeq = uint(0)
-	liveCB    = map[uint]*liveCBEnt{}
-	liveSTSeq = uint(0)
-	liveST    = map[uint]*liveSTEnt{}
-	liveMX    = &sync.RWMutex{}
-)
+// ExitError reports a call to exit() from Perl code.  The interpreter
+// remains usable.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// LimitError reports Perl code stopped for exceeding the MaxOps or
+// MaxLive budget of a PL.  The interpreter remains usable.
+type LimitError struct {
+	Resource string // "ops" or "live"
+	Limit    int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit %d exceeded", e.Resource, e.Limit)
+}
+
+// Callbacks from Perl find their PL by interpreter.  This does not
+// keep the PL alive.  Close(), which the finalizer of an unreachable
+// PL also runs, holds the PL itself here while Perl is torn down, as
+// the weak pointer is already cleared by then, and then removes it.
+var livePL sync.Map // *C.PerlInterpreter => weak.Pointer[PL] or *PL
+
+// addPL readies a new PL's registry and makes it known to callbacks
+func addPL(pl *PL) {
+	if pl.liveCB == nil {
+		pl.liveCB = map[uint]*liveCBEnt{}
+		pl.liveST = map[uint]*liveSTEnt{}
+	}
+	livePL.Store(pl.thx, weak.Make(pl))
+}
+
+func plOf(thx *C.PerlInterpreter) *PL {
+	p, _ := livePL.Load(thx)
+	if pl, ok := p.(*PL); ok {
+		return pl
+	}
+	return p.(weak.Pointer[PL]).Value()
+}
+
+// ErrClosed is reported by calls on a PL after Close()
+var ErrClosed = errors.New("interpreter is closed")
+
+// ErrForeign is reported when a Perl value from one PL is handed to
+// another.
+var ErrForeign = errors.New("value belongs to another interpreter")
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
 
 func plFini(pl *PL) {
+	pl.Close()
+}
+
+// Clone copies the interpreter with perl_clone(), the new PL has all
+// the modules, subs and globals already loaded into this one but is
+// otherwise independent.  Perl must be built with ithreads.
+func (pl *PL) Clone() (cl *PL, err error) {
+	if pl.away() {
+		pl.exec(func() { cl, err = pl.Clone() })
+		return
+	}
+	if pl.closed() {
+		return nil, ErrClosed
+	}
+	cl = &PL{
+		cx:        make(chan bool, 1),
+		Preamble:  pl.Preamble,
+		MaxOps:    pl.MaxOps,
+		MaxLive:   pl.MaxLive,
+		budget:    pl.budget,
+		liveCBSeq: pl.liveCBSeq,
+		liveCB:    map[uint]*liveCBEnt{},
+		liveSTSeq: pl.liveSTSeq,
+		liveST:    map[uint]*liveSTEnt{},
+	}
+	// perl_clone() counts the references it copies into the clone
+	pl.liveMX.RLock()
+	for id, ent := range pl.liveCB {
+		dup := *ent
+		dup.live = 0
+		cl.liveCB[id] = &dup
+	}
+	for id, ent := range pl.liveST {
+		dup := *ent
+		dup.live = 0
+		cl.liveST[id] = &dup
+	}
+	pl.liveMX.RUnlock()
 	pl.enter()
-	C.glue_fini(pl.thx)
+	pl.cloning = cl
+	cl.thx = C.glue_clone(pl.thx)
+	pl.cloning = nil
 	pl.leave()
+	if cl.thx == nil {
+		return nil, errors.New("perl_clone() needs a Perl built with ithreads")
+	}
+	if pl.exe != nil {
+		cl.exe = newExecutor()
+	}
+	for id, ent := range cl.liveCB {
+		if ent.live == 0 {
+			delete(cl.liveCB, id)
+		}
+	}
+	for id, ent := range cl.liveST {
+		if ent.live == 0 {
+			delete(cl.liveST, id)
+		}
+	}
+	addPL(cl)
+	runtime.SetFinalizer(cl, plFini)
+	cl.cx <- true
+	// the Go::Loop hooks it inherited belong to pl
+	cl.loopInit()
+	return cl, nil
+}
+
+// Close runs END blocks and destroys the Perl runtime.  Once Close()
+// has begun, further calls on the PL, or on values and functions
+// obtained from it, report ErrClosed.
+func (pl *PL) Close() (err error) {
+	if pl.away() {
+		pl.exec(func() { err = pl.Close() })
+		return
+	}
+	if pl.inside() {
+		return errors.New("Close() from within a call into Perl")
+	}
+	if !atomic.CompareAndSwapInt32(&pl.closing, 0, 1) {
+		return ErrClosed
+	}
+	runtime.SetFinalizer(pl, nil)
+	pl.enter()
+	livePL.Store(pl.thx, pl)
+	rv := C.glue_fini(pl.thx)
+	livePL.CompareAndDelete(pl.thx, pl)
+	pl.thx = nil
+	// Perl has let go of everything by now
+	pl.liveMX.Lock()
+	pl.liveCB = nil
+	pl.liveST = nil
+	pl.liveMX.Unlock()
+	pl.depth = 0
+	atomic.StoreUint64(&pl.owner, 0)
+	runtime.UnlockOSThread()
+	close(pl.cx)
+	pl.loop.close()
+	if pl.exe != nil {
+		close(pl.exe.stop)
+	}
+	if rv != 0 {
+		return fmt.Errorf("perl_destruct() exit status %d", int(rv))
+	}
+	return nil
+}
+
+func (pl *PL) closed() bool {
+	return atomic.LoadInt32(&pl.closing) != 0
 }
 
 // New initializes a Perl runtime
 func New() *PL {
+	pl, err := NewWithOptions(Options{})
+	if err != nil {
+		panic(err)
+	}
+	return pl
+}
+
+// Options configure a Perl runtime created by NewWithOptions().
+type Options struct {
+	Inc      []string // directories prepended to @INC, like -I
+	Modules  []string // modules loaded at startup, like -M
+	Taint    bool     // enable taint checks, like -T
+	Warnings bool     // enable warnings, like -w
+	Args     []string // initial @ARGV
+	Script   string   // initial $0, if not empty
+	// If Env is not nil, it replaces %ENV with "key=value" entries
+	// and changes to %ENV will no longer affect the process
+	// environment.
+	Env []string
+	// If Sandbox is not nil, Perl code is restricted once the
+	// interpreter is set up, Modules are loaded before that.
+	Sandbox *Sandbox
+	// If Exec is not nil, Perl's system(), exec() and backticks run
+	// commands with os/exec rather than forking this process.
+	Exec *Exec
+	// If Pinned is set, all of the interpreter's work is done on one
+	// OS thread, for the sake of XS modules that expect that.  Go
+	// callbacks from Perl run there too.  Calls from other goroutines
+	// wait their turn, even while a callback has the thread.
+	Pinned bool
+}
+
+// Exec configures how Perl code runs commands.  The command runs with
+// Perl's %ENV, is killed if the Context of the call into Perl is
+// done, and $? and $! are set as Perl's own versions would.  exec()
+// can not replace this process, instead it waits for the command and
+// then exits with its status, see ExitError.  Along with a Sandbox,
+// only the commands it allows the ops for, "system", "exec" or
+// "backtick", are run this way, the rest stay denied.
+type Exec struct {
+	// If Allow is not nil, only the commands it lists may run, any
+	// other fails with EACCES.  Commands match by the name Perl was
+	// given, those that need a shell run as "/bin/sh".
+	Allow []string
+	// Stdout and Stderr receive the command's output, or it is
+	// discarded if nil.  Backticks capture stdout themselves.
+	Stdout io.Writer
+	Stderr io.Writer
+	Dir    string // working directory of the command, if not empty
+}
+
+// run starts a command and waits for it, returning a $? wait status
+// or an errno if it could not start.
+func (ex *Exec) run(ctx context.Context, capture bool, args []string, env []string) (int, string, int) {
+	if len(args) == 0 || args[0] == "" {
+		return -1, "", int(syscall.ENOENT)
+	}
+	if ex.Allow != nil && !contains(ex.Allow, args[0]) {
+		return -1, "", int(syscall.EACCES)
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = env
+	cmd.Dir = ex.Dir
+	cmd.Stdout = ex.Stdout
+	cmd.Stderr = ex.Stderr
+	var out strings.Builder
+	if capture {
+		cmd.Stdout = &out
+	}
+	err := cmd.Run()
+	if cmd.ProcessState == nil {
+		var errno syscall.Errno
+		if errors.As(err, &errno) {
+			return -1, "", int(errno)
+		}
+		if errors.Is(err, exec.ErrNotFound) {
+			return -1, "", int(syscall.ENOENT)
+		}
+		return -1, "", int(syscall.EINVAL)
+	}
+	ws := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if ws.Signaled() {
+		status := int(ws.Signal())
+		if ws.CoreDump() {
+			status |= 128
+		}
+		return status, out.String(), 0
+	}
+	return ws.ExitStatus() << 8, out.String(), 0
+}
+
+func contains(lst []string, str string) bool {
+	for _, v := range lst {
+		if v == str {
+			return true
+		}
+	}
+	return false
+}
+
+// apply overrides Perl's builtins for running commands.  The
+// overrides compile to sub calls that an op mask can't see, so with a
+// Sandbox only those for ops it allows are installed.
+func (ex *Exec) apply(pl *PL, sb *Sandbox) {
+	var install func(func(context.Context, bool, []string, []string) (int, string, int), bool, []string)
+	pl.Eval(`sub {
+		my($run, $sandboxed, $allow) = @_;
+		my %ok = map { $_ => 1 } qw(system exec backtick);
+		if($sandboxed) {
+			require Opcode;
+			%ok = map { $_ => 1 } eval { Opcode::opset_to_ops(Opcode::opset(@$allow)) };
+		}
+		my $cmd = sub {
+			my @cmd = map "$_", @_;
+			if(@cmd == 1) {
+				@cmd = $cmd[0] =~ /[\$&*(){}\[\]'";\\|?<>~\x60\n]/
+					? ('/bin/sh', '-c', $cmd[0])
+					: split ' ', $cmd[0];
+			}
+			return \@cmd, [ map "$_=$ENV{$_}", keys %ENV ];
+		};
+		no warnings 'redefine';
+		*CORE::GLOBAL::system = sub {
+			my($status, $out, $errno) = $run->(0, $cmd->(@_));
+			$! = $errno if $errno;
+			return $? = $status;
+		} if $ok{system};
+		*CORE::GLOBAL::readpipe = sub {
+			my($status, $out, $errno) = $run->(1, $cmd->(@_ ? $_[0] : $_));
+			$? = $status;
+			if($errno) {
+				$! = $errno;
+				return;
+			}
+			return wantarray ? split /^/, $out : $out;
+		} if $ok{backtick};
+		*CORE::GLOBAL::exec = sub {
+			my($status, $out, $errno) = $run->(0, $cmd->(@_));
+			if($errno) {
+				$! = $errno;
+				return 0;
+			}
+			exit($status & 127 ? 128 + ($status & 127) : $status >> 8);
+		} if $ok{exec};
+		return;
+	}`, &install)
+	if sb == nil {
+		install(ex.run, false, nil)
+	} else {
+		install(ex.run, true, sb.Allow)
+	}
+}
+
+// Sandbox restricts the Perl code an interpreter will compile, in the
+// manner of Safe.pm.  Only the ops in Opcode's :default set are
+// allowed, which rules out system(), backticks, open(), fork(),
+// require and sockets among others.  Note that "use" needs require.
+type Sandbox struct {
+	// Allow lists further op names or Opcode tags to permit,
+	// e.g. "print" or ":base_io".
+	Allow []string
+	// Funcs are installed as Perl subs under the given names, so
+	// sandboxed code may call into Go where an op would be denied.
+	Funcs map[string]interface{}
+}
+
+var funcRE = regexp.MustCompile(`^[A-Za-z_]\w*(::\w+)*$`)
+
+// apply installs the sandbox's Funcs then masks the ops it denies.
+func (sb *Sandbox) apply(pl *PL) error {
+	var err error
+	var install func(string, interface{}) error
+	pl.Eval(`sub { no strict 'refs'; *{ $_[0] } = $_[1]; return }`, &install)
+	for name, fn := range sb.Funcs {
+		if !funcRE.MatchString(name) {
+			return fmt.Errorf("invalid Sandbox func name %q", name)
+		}
+		if fn == nil || reflect.TypeOf(fn).Kind() != reflect.Func {
+			return fmt.Errorf("Sandbox func %s is a %T", name, fn)
+		}
+		if err = install(name, fn); err != nil {
+			return err
+		}
+	}
+	// plgo's own helpers may not load modules once the mask is on,
+	// see glue_eval(), so what they need is loaded now
+	var mask func([]string) error
+	pl.Eval(`sub {
+		require Opcode;
+		require Math::Complex;
+		Opcode::opmask_add(Opcode::invert_opset(Opcode::opset(':default', @{ $_[0] })));
+		return;
+	}`, &mask)
+	if err = mask(sb.Allow); err != nil {
+		return fmt.Errorf("invalid Sandbox: %v", err)
+	}
+	return nil
+}
+
+var moduleRE = regexp.MustCompile(`^-?[A-Za-z_]\w*(::\w+)*(=.*)?$`)
+
+// argv builds the command line handed to perl_parse()
+func (opts *Options) argv() ([]string, error) {
+	argv := []string{""}
+	if opts.Taint {
+		argv = append(argv, "-T")
+	}
+	if opts.Warnings {
+		argv = append(argv, "-w")
+	}
+	for _, dir := range opts.Inc {
+		if dir == "" || strings.ContainsRune(dir, 0) {
+			return nil, fmt.Errorf("invalid Inc directory %q", dir)
+		}
+		argv = append(argv, "-I"+dir)
+	}
+	for _, mod := range opts.Modules {
+		if !moduleRE.MatchString(mod) || strings.ContainsRune(mod, 0) {
+			return nil, fmt.Errorf("invalid module %q", mod)
+		}
+		argv = append(argv, "-M"+mod)
+	}
+	argv = append(argv, "-e", "0", "--")
+	for _, arg := range opts.Args {
+		if strings.ContainsRune(arg, 0) {
+			return nil, fmt.Errorf("invalid argument %q", arg)
+		}
+		argv = append(argv, arg)
+	}
+	return argv, nil
+}
+
+func (opts *Options) env() ([]string, error) {
+	for _, ent := range opts.Env {
+		if strings.IndexByte(ent, '=') < 1 || strings.ContainsRune(ent, 0) {
+			return nil, fmt.Errorf("invalid Env entry %q", ent)
+		}
+	}
+	return opts.Env, nil
+}
+
+// cStrings copies lst to a NULL terminated C array, the receiver is
+// responsible for freeing it.
+func cStrings(lst []string) **C.char {
+	ptr := (**C.char)(C.malloc(C.size_t(1+len(lst)) * C.size_t(unsafe.Sizeof((*C.char)(nil)))))
+	arr := (*[1 << 28]*C.char)(unsafe.Pointer(ptr))[: 1+len(lst) : 1+len(lst)]
+	for i, str := range lst {
+		arr[i] = C.CString(str)
+	}
+	arr[len(lst)] = nil
+	return ptr
+}
+
+// NewWithOptions initializes a Perl runtime configured by opts.  If
+// one of the Modules calls exit(), it fails with an ExitError.
+func NewWithOptions(opts Options) (*PL, error) {
+	argv, err := opts.argv()
+	if err != nil {
+		return nil, err
+	}
+	env, err := opts.env()
+	if err != nil {
+		return nil, err
+	}
+	if strings.ContainsRune(opts.Script, 0) {
+		return nil, fmt.Errorf("invalid Script %q", opts.Script)
+	}
+	var cenv **C.char
+	if env != nil {
+		cenv = cStrings(env)
+	}
+	var script *C.char
+	if opts.Script != "" {
+		script = C.CString(opts.Script)
+	}
+
 	pl := new(PL)
-	pl.thx = C.glue_init()
+	if opts.Pinned {
+		pl.exe = newExecutor()
+	}
+	var errp *C.char
+	var code C.IV
+	pl.exec(func() {
+		pl.thx = C.glue_init(C.int(len(argv)), cStrings(argv), cenv, script, &errp, &code)
+	})
+	if pl.thx == nil {
+		if pl.exe != nil {
+			close(pl.exe.stop)
+		}
+		if errp == nil {
+			return nil, &ExitError{int(code)}
+		}
+		defer C.free(unsafe.Pointer(errp))
+		return nil, fmt.Errorf("%s", strings.TrimSpace(C.GoString(errp)))
+	}
 	pl.cx = make(chan bool, 1)
+	addPL(pl)
 	runtime.SetFinalizer(pl, plFini)
 	pl.cx <- true // this PL is now open for business
-	return pl
+	pl.loopInit()
+	if opts.Exec != nil {
+		opts.Exec.apply(pl, opts.Sandbox)
+	}
+	if opts.Sandbox != nil {
+		if err := opts.Sandbox.apply(pl); err != nil {
+			pl.Close()
+			return nil, err
+		}
+	}
+	return pl, nil
 }
 
 func sliceOf(raw **C.SV, n int) []*C.SV {
@@ -83,6 +577,15 @@ func sliceOf(raw **C.SV, n int) []*C.SV {
 	}))
 }
 
+// lenOf counts the SVs in a NULL terminated list
+func lenOf(raw **C.SV) int {
+	n := 0
+	for p := unsafe.Pointer(raw); *(**C.SV)(p) != nil; p = unsafe.Add(p, unsafe.Sizeof(raw)) {
+		n++
+	}
+	return n
+}
+
 /* error handling though this code is a bit unconventional.  The API
  * style we're providing lets the caller decide if we should populate an
  * error object return value, or panic().  We have a helper function to
@@ -127,9 +630,189 @@ func splitErrs(rets []reflect.Value) (outs []reflect.Value, ef errFunc) {
 // Not all types are supported, but many basic types are, including
 // functions.
 func (pl *PL) Eval(text string, ptrs ...interface{}) {
-	var av *C.SV
+	pl.EvalContext(context.Background(), text, ptrs...)
+}
+
+// EvalContext is Eval() bounded by ctx.  If ctx is done before the
+// Perl code completes, the code is interrupted at the next safe point
+// and ctx.Err() is the resulting error.
+func (pl *PL) EvalContext(ctx context.Context, text string, ptrs ...interface{}) {
+	pl.eval(ctx, false, false, text, ptrs...)
+}
+
+// EvalScalar is Eval() with the code in scalar context, rather than
+// the list context Eval() gives it, so there is a single result.
+// Results differ for code like localtime() that checks its context.
+func (pl *PL) EvalScalar(text string, ptrs ...interface{}) {
+	pl.eval(context.Background(), false, true, text, ptrs...)
+}
+
+// evalTrusted is Eval() for plgo's own helpers, which must work even
+// when a Sandbox masks the ops they use.
+func (pl *PL) evalTrusted(text string, ptrs ...interface{}) {
+	pl.eval(context.Background(), true, false, text, ptrs...)
+}
+
+func (pl *PL) eval(ctx context.Context, trusted, scalar bool, text string, ptrs ...interface{}) {
+	if pl.away() {
+		pl.exec(func() { pl.eval(ctx, trusted, scalar, text, ptrs...) })
+		return
+	}
+	rets, errf := splitErrs(ptrValues(ptrs))
+	if pl.closed() {
+		if errf(ErrClosed) {
+			return
+		}
+		panic(ErrClosed)
+	}
+
+	av, err := pl.evalAV(ctx, trusted, scalar, text)
+	if err != nil {
+		if errf(err) {
+			return
+		}
+		panic(err)
+	}
+	defer func() {
+		pl.enter()
+		C.glue_dec(pl.thx, av)
+		pl.leave()
+	}()
+	pl.copyOut(av, rets, errf)
+}
+
+// EvalAsync is EvalContext() run from the PL's Post() queue, the
+// returned Future collects the results.
+func (pl *PL) EvalAsync(ctx context.Context, text string) *Future {
+	return pl.async(func() (*sV, error) {
+		av, err := pl.evalAV(ctx, false, false, text)
+		if err != nil {
+			return nil, err
+		}
+		list := pl.sV(av, true)
+		pl.enter()
+		C.glue_dec(pl.thx, av)
+		pl.leave()
+		return list, nil
+	})
+}
+
+// Future is the pending result of a call into Perl made by EvalAsync()
+// or by a Perl sub bound to a func returning *Future, e.g.
+//
+//	var sum func(...) *plgo.Future
+//
+// Such funcs queue the call with Post() and return right away.
+type Future struct {
+	pl   *PL
+	done chan struct{}
+	list *sV // ref to an array of the results
+	err  error
+}
+
+var futureType = reflect.TypeOf((*Future)(nil))
+
+func (pl *PL) async(run func() (*sV, error)) *Future {
+	f := &Future{pl: pl, done: make(chan struct{})}
+	pl.post(post{
+		run: func(*PL) {
+			defer close(f.done)
+			f.list, f.err = run()
+		},
+		drop: func() {
+			f.err = ErrClosed
+			close(f.done)
+		},
+	})
+	return f
+}
+
+// Done is closed once the results are ready.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
 
-	// convert ptrs to Values
+// Wait waits for the call to finish, then converts the values it
+// returned into ptrs as Eval() would.  It returns the error the call
+// failed with, or the first one converting its values.
+func (f *Future) Wait(ptrs ...interface{}) error {
+	<-f.done
+	if f.err != nil {
+		return f.err
+	}
+	rets := ptrValues(ptrs)
+	var err error
+	errh := func(ev error) bool {
+		if err == nil {
+			err = ev
+		}
+		return true
+	}
+	f.pl.exec(func() {
+		if f.pl.closed() {
+			err = ErrClosed
+			return
+		}
+		f.pl.copyOut(f.list.sv, rets, errh)
+	})
+	return err
+}
+
+// initListCall makes pl.listCall on first use.
+func (pl *PL) initListCall() {
+	if pl.listCall == nil {
+		pl.evalTrusted(`sub { my $f = shift; [ $f->(@_) ] }`, &pl.listCall)
+	}
+}
+
+// asyncFunc binds cv to dst, a func returning *Future.  The call is
+// made through a Perl helper that collects the results in an array.
+func (pl *PL) asyncFunc(dst *reflect.Value, cv *sV, hasCtx bool, errf errFunc) bool {
+	t := dst.Type()
+	pl.initListCall()
+	off := 0
+	in := []reflect.Type{}
+	if hasCtx {
+		in = append(in, contextType)
+		off = 1
+	}
+	in = append(in, reflect.TypeOf(cv))
+	for i := off; i < t.NumIn(); i++ {
+		in = append(in, t.In(i))
+	}
+	out := []reflect.Type{reflect.TypeOf(cv), reflect.TypeOf((*error)(nil)).Elem()}
+	call := reflect.New(reflect.FuncOf(in, out, t.IsVariadic())).Elem()
+	if !pl.decode(&call, pl.listCall.sv, errf) {
+		return false
+	}
+	dst.Set(reflect.MakeFunc(t, func(arg []reflect.Value) []reflect.Value {
+		args := make([]reflect.Value, 0, 1+len(arg))
+		args = append(args, arg[:off]...)
+		args = append(args, reflect.Value{}) // cv goes here
+		args = append(args, arg[off:]...)
+		return []reflect.Value{reflect.ValueOf(pl.async(func() (*sV, error) {
+			// handing an *sV to Perl gives away a reference
+			args[off] = reflect.ValueOf(pl.sV(cv.sv, false))
+			var rv []reflect.Value
+			if t.IsVariadic() {
+				rv = call.CallSlice(args)
+			} else {
+				rv = call.Call(args)
+			}
+			if err, _ := rv[1].Interface().(error); err != nil {
+				return nil, err
+			}
+			list := rv[0].Interface().(*sV)
+			list.own = true
+			return list, nil
+		}))}
+	}))
+	return true
+}
+
+// ptrValues zeroes what each of ptrs points to and returns them as
+// settable Values.
+func ptrValues(ptrs []interface{}) []reflect.Value {
 	rets := make([]reflect.Value, len(ptrs))
 	for i, p := range ptrs {
 		ptr := reflect.ValueOf(p)
@@ -140,54 +823,296 @@ func (pl *PL) Eval(text string, ptrs ...interface{}) {
 			panic(fmt.Errorf("argument %d must be a pointer", 1+i))
 		}
 	}
-	rets, errf := splitErrs(rets)
+	return rets
+}
 
-	// run eval()
-	code := C.CString(pl.Preamble + "; [ do { \n#line 1 \"plgo.Eval()\"\n" + text + "\n } ]")
-	var errsv *C.SV
-	pl.enter()
-	av = C.glue_eval(pl.thx, code, &errsv)
-	pl.leave()
-	defer func() {
+// evalAV runs text and returns an owned reference to the list of
+// values it returned.
+func (pl *PL) evalAV(ctx context.Context, trusted, scalar bool, text string) (*C.SV, error) {
+	var av, errsv *C.SV
+	want := "[ do {"
+	if scalar {
+		want = "[ scalar do {"
+	}
+	err := pl.run(ctx, func() {
+		code := C.CString(pl.Preamble + "; " + want + " \n#line 1 \"plgo.Eval()\"\n" + text + "\n } ]")
+		av = C.glue_eval(pl.thx, code, C.bool(trusted), &errsv)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if errsv != nil {
+		err = pl.perlErr(ctx, errsv)
 		pl.enter()
 		C.glue_dec(pl.thx, av)
 		C.glue_dec(pl.thx, errsv)
 		pl.leave()
-	}()
-	if errsv != nil {
-		err := pl.sV(errsv, true)
-		if errf(err) {
-			return
+		return nil, err
+	}
+	return av, nil
+}
+
+// copyOut converts the list av refers to into rets, any missing
+// values are left as they are.
+func (pl *PL) copyOut(av *C.SV, rets []reflect.Value, errf errFunc) {
+	if len(rets) == 0 {
+		return
+	}
+	cb := func(raw **C.SV, n C.IV) {
+		lst := sliceOf(raw, int(n))
+		for i, v := range rets {
+			if v.Type().Implements(listType) {
+				// a List takes the rest, as an array would in
+				// Perl's list assignment
+				pl.decodeList(&v, lst[min(i, len(lst)):], errf)
+				break
+			}
+			if i >= len(lst) {
+				break
+			}
+			pl.decode(&v, lst[i], errf)
 		}
-		panic(err)
 	}
+	ptr := C.UV(uintptr(unsafe.Pointer(&cb)))
+	pl.enter()
+	defer pl.leave()
+	C.glue_walkAV(pl.thx, av, ptr)
+}
 
-	if len(rets) > 0 {
-		// copy out rets
-		cb := func(raw **C.SV, n C.IV) {
-			pl.leave()
-			defer pl.enter()
-			lst := sliceOf(raw, int(n))
-			for i, v := range rets {
-				pl.getSV(&v, lst[i], errf)
+// executor runs all of a pinned PL's Perl work on one locked OS
+// thread, see Options.Pinned.  It does not refer to the PL so that an
+// unused PL may still be collected.
+type executor struct {
+	tid  C.UV
+	jobs chan func()
+	stop chan struct{}
+}
+
+func newExecutor() *executor {
+	ex := &executor{jobs: make(chan func()), stop: make(chan struct{})}
+	ready := make(chan bool)
+	go func() {
+		// never unlocked, the thread exits along with us
+		runtime.LockOSThread()
+		ex.tid = C.glue_thread()
+		close(ready)
+		for {
+			select {
+			case f := <-ex.jobs:
+				f()
+			case <-ex.stop:
+				return
 			}
 		}
-		ptr := C.UV(uintptr(unsafe.Pointer(&cb)))
-		pl.enter()
-		C.glue_walkAV(pl.thx, av, ptr, false)
-		pl.leave()
+	}()
+	<-ready
+	return ex
+}
+
+// away reports if this goroutine must hand Perl work to the PL's
+// pinned thread.  Once the PL is closed there is no need.
+func (pl *PL) away() bool {
+	if pl.exe == nil {
+		return false
+	}
+	select {
+	case <-pl.exe.stop:
+		return false
+	default:
+	}
+	return C.glue_thread() != pl.exe.tid
+}
+
+// exec runs f on the PL's pinned thread and waits for it, or just
+// runs f if there is no need to hand it over.
+func (pl *PL) exec(f func()) {
+	if !pl.away() {
+		f()
+		return
+	}
+	var p interface{}
+	done := make(chan bool)
+	job := func() {
+		defer close(done)
+		defer func() { p = recover() }()
+		f()
+	}
+	select {
+	case pl.exe.jobs <- job:
+	case <-pl.exe.stop:
+		// the PL is closed, f will find out for itself
+		f()
+		return
+	}
+	<-done
+	if p != nil {
+		panic(p)
 	}
 }
 
 // use this before any batch of C.glue_* calls
 func (pl *PL) enter() {
-	<-pl.cx
+	if !pl.acquire() {
+		panic(ErrClosed)
+	}
+}
+
+// acquire is enter() for callers that can not panic, it reports false
+// if the PL has been closed.
+func (pl *PL) acquire() bool {
+	return pl.enterContext(context.Background()) == nil
+}
+
+// enterContext is enter() that gives up waiting once ctx is done.
+//
+// The PL is held from the outermost call into Perl until it returns,
+// including while Perl calls back into Go.  The goroutine holding it
+// stays on its OS thread meanwhile, so it is known by the thread and
+// its calls re-enter, while other goroutines wait their turn.
+func (pl *PL) enterContext(ctx context.Context) error {
+	runtime.LockOSThread()
+	tid := uint64(C.glue_thread())
+	if atomic.LoadUint64(&pl.owner) == tid {
+		pl.depth++
+		// Go may have called into another PL on this thread
+		C.glue_setContext(pl.thx)
+		return nil
+	}
+	select {
+	case _, ok := <-pl.cx:
+		if !ok {
+			runtime.UnlockOSThread()
+			return ErrClosed
+		}
+	case <-ctx.Done():
+		runtime.UnlockOSThread()
+		return ctx.Err()
+	}
+	atomic.StoreUint64(&pl.owner, tid)
+	pl.depth = 1
 	C.glue_setContext(pl.thx)
+	return nil
+}
+
+// run makes a call into Perl with f, which should be a single
+// glue_eval() or glue_call_sv(), bounded by ctx and the PL's budgets.
+func (pl *PL) run(ctx context.Context, f func()) error {
+	if err := pl.enterContext(ctx); err != nil {
+		return err
+	}
+	if pl.MaxOps != pl.budget[0] || pl.MaxLive != pl.budget[1] {
+		C.glue_budget(pl.thx, C.IV(pl.MaxOps), C.IV(pl.MaxLive))
+		pl.budget = [2]int{pl.MaxOps, pl.MaxLive}
+	}
+	prev := pl.ctx
+	pl.ctx = ctx
+	stop := pl.watch(ctx)
+	f()
+	stop()
+	pl.ctx = prev
+	pl.leave()
+	return nil
+}
+
+// watch interrupts running Perl code if ctx is done before stop() is
+// called.  Both should be called while the PL is entered.
+func (pl *PL) watch(ctx context.Context) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	done := make(chan bool)
+	fired := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			C.glue_interrupt(pl.thx, 1)
+			fired <- true
+		case <-done:
+			fired <- false
+		}
+	}()
+	return func() {
+		close(done)
+		if <-fired {
+			C.glue_interrupt(pl.thx, -1)
+		}
+	}
+}
+
+// context is the Context of the innermost call into Perl, it is
+// handed to Go callbacks that ask for one.
+func (pl *PL) context() context.Context {
+	if pl.ctx == nil {
+		return context.Background()
+	}
+	return pl.ctx
+}
+
+// inside reports if this goroutine holds the PL
+func (pl *PL) inside() bool {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	return atomic.LoadUint64(&pl.owner) == uint64(C.glue_thread())
 }
 
 // use this after any batch of C.glue_* calls
 func (pl *PL) leave() {
-	pl.cx <- true
+	pl.depth--
+	if pl.depth == 0 {
+		atomic.StoreUint64(&pl.owner, 0)
+		pl.cx <- true
+	}
+	runtime.UnlockOSThread()
+}
+
+// Post schedules f to run once the PL is idle, and returns without
+// waiting for it.  Posted funcs run one at a time in the order they
+// were posted, and are dropped if the PL is closed first.  Goroutines
+// started by a Go callback must wait for the outermost call into Perl
+// to return before they get the PL, so a callback that needs work
+// done in Perl after it returns should Post() it.
+func (pl *PL) Post(f func(*PL)) {
+	pl.post(post{run: f})
+}
+
+type post struct {
+	run  func(*PL)
+	drop func() // if not nil, called in place of run once closed
+}
+
+func (pl *PL) post(p post) {
+	pl.postMX.Lock()
+	pl.posts = append(pl.posts, p)
+	start := len(pl.posts) == 1
+	pl.postMX.Unlock()
+	if start {
+		go pl.runPosts()
+	}
+}
+
+func (pl *PL) runPosts() {
+	for {
+		// the head stays queued until it is done, so Post() knows
+		// a runner is going
+		pl.postMX.Lock()
+		p := pl.posts[0]
+		pl.postMX.Unlock()
+		pl.exec(func() {
+			if pl.acquire() {
+				defer pl.leave()
+				p.run(pl)
+			} else if p.drop != nil {
+				p.drop()
+			}
+		})
+		pl.postMX.Lock()
+		pl.posts = pl.posts[1:]
+		more := len(pl.posts) > 0
+		pl.postMX.Unlock()
+		if !more {
+			return
+		}
+	}
 }
 
 // Live counts the number of live variables in the Perl instance.
@@ -195,460 +1120,214 @@ func (pl *PL) leave() {
 // runtime.GC() must be called to get accurate live value counts.
 func (pl *PL) Live() int {
 	var rv C.IV
-	pl.enter()
-	rv = C.glue_count_live(pl.thx)
-	pl.leave()
+	pl.exec(func() {
+		pl.enter()
+		rv = C.glue_count_live(pl.thx)
+		pl.leave()
+	})
 	return int(rv)
 }
 
+// setSV converts src into *ptr, entering the PL to do so.
 func (pl *PL) setSV(ptr **C.SV, src reflect.Value, errf errFunc) bool {
-	t := src.Type()
-	switch src.Kind() {
-	case reflect.Bool:
-		pl.enter()
-		C.glue_setBool(pl.thx, ptr, C.bool(src.Bool()))
-		pl.leave()
-		return true
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		pl.enter()
-		C.glue_setIV(pl.thx, ptr, C.IV(src.Int()))
-		pl.leave()
-		return true
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-		pl.enter()
-		C.glue_setUV(pl.thx, ptr, C.UV(src.Uint()))
-		pl.leave()
-		return true
-	case reflect.Float32, reflect.Float64:
-		pl.enter()
-		C.glue_setNV(pl.thx, ptr, C.NV(src.Float()))
-		pl.leave()
-		return true
-	case reflect.Complex64, reflect.Complex128:
-		if pl.newSVcmplx == nil {
-			pl.Eval(`
-				require Math::Complex;
-				sub {
-					my $rv = Math::Complex->new(0, 0);
-					$rv->_set_cartesian([ @_ ]);
-					return $rv;
-				}
-			`, &pl.newSVcmplx)
-		}
-		v := src.Complex()
-		sv := pl.newSVcmplx(real(v), imag(v))
-		*ptr = sv.sv
-		return true
-	case reflect.Array,
-		reflect.Slice:
-		if t.Elem().Kind() == reflect.Uint8 {
-			// []byte is special
-			lala := src.Bytes()
-			pl.enter()
-			C.glue_setPVB(pl.thx, ptr, C.CBytes(lala), C.STRLEN(src.Len()))
-			pl.leave()
-			return true
-		}
-		lst := make([]*C.SV, 1+src.Len())
-		for i := range lst[0 : len(lst)-1] {
-			if !pl.setSV(&lst[i], src.Index(i), errf) {
-				return false
-			}
+	pl.enter()
+	defer pl.leave()
+	return pl.encode(ptr, src, errf)
+}
+
+// getSV converts src into *dst, entering the PL to do so.
+func (pl *PL) getSV(dst *reflect.Value, src *C.SV, errf errFunc) bool {
+	pl.enter()
+	defer pl.leave()
+	return pl.decode(dst, src, errf)
+}
+
+// encode is setSV() for when the PL is already entered
+func (pl *PL) encode(ptr **C.SV, src reflect.Value, errf errFunc) bool {
+	return codecOf(src.Type()).enc(pl, ptr, src, errf)
+}
+
+// decode is getSV() for when the PL is already entered
+func (pl *PL) decode(dst *reflect.Value, src *C.SV, errf errFunc) bool {
+	return codecOf(dst.Type()).dec(pl, dst, src, errf)
+}
+
+// newFH wraps Go values that implement io.Reader or io.Writer in a
+// tied Perl filehandle.  It returns nil for any other value.
+func (pl *PL) newFH(src reflect.Value) *sV {
+	if !src.CanInterface() {
+		return nil
+	}
+	rd, _ := src.Interface().(io.Reader)
+	wr, _ := src.Interface().(io.Writer)
+	cl, _ := src.Interface().(io.Closer)
+	if rd == nil && wr == nil {
+		return nil
+	}
+	if pl.newSVfh == nil {
+		pl.evalTrusted(`sub { Go::Handle->new(@_) }`, &pl.newSVfh)
+	}
+	// Perl sees errors as plain strings here, Go::Handle turns them
+	// into a failed I/O op with $! set.
+	read := func(n int) (string, string) {
+		if rd == nil {
+			return "", "filehandle opened only for output"
 		}
-		pl.enter()
-		C.glue_setAV(pl.thx, ptr, &lst[0])
-		pl.leave()
-		return true
-	case reflect.Chan:
-	case reflect.Func:
-		call := func(arg **C.SV) (ret **C.SV) {
-			// TODO: need an error proxy
-			pl.leave()
-			defer pl.enter()
-			// xlate args - they are already mortal, don't take
-			// ownership unless they need to survive beyond the
-			// function call
-			args := make([]reflect.Value, t.NumIn())
-			for i, sv := range sliceOf(arg, len(args)) {
-				args[i] = reflect.New(t.In(i)).Elem()
-				pl.getSV(&args[i], sv, errf)
+		buf := make([]byte, n)
+		// an io.Reader may return no data without an error, but the
+		// tie interprets empty reads as EOF, so retry a bit.
+		for i := 0; i < 100; i++ {
+			n, err := rd.Read(buf)
+			if n > 0 || err == io.EOF {
+				return string(buf[:n]), ""
 			}
-			// xlate rets - return as owning references and
-			// glue_invoke() will mortalize them for us
-			ret = C.glue_alloc(C.IV(1 + t.NumOut()))
-			rets := sliceOf(ret, t.NumOut())
-			for i, val := range src.Call(args) {
-				pl.setSV(&rets[i], val, errf)
+			if err != nil {
+				return "", err.Error()
 			}
-			return
 		}
-		liveMX.Lock()
-		liveCBSeq++
-		id := liveCBSeq
-		liveCB[liveCBSeq] = &liveCBEnt{call, src}
-		liveMX.Unlock()
-		pl.enter()
-		C.glue_setCV(pl.thx, ptr, C.UV(id))
-		pl.leave()
-		return true
-	case reflect.Interface:
-	case reflect.Map:
-		keys := src.MapKeys()
-		lst := make([]*C.SV, len(keys)<<1+1)
-		for i, key := range keys {
-			if !pl.setSV(&lst[i<<1], key, errf) {
-				return false
-			}
-			if !pl.setSV(&lst[i<<1+1], src.MapIndex(key), errf) {
-				return false
-			}
-		}
-		pl.enter()
-		C.glue_setHV(pl.thx, ptr, &lst[0])
-		pl.leave()
-		return true
-	case reflect.Ptr:
-		// TODO: *sV handling is a special case, but generic Ptr support
-		// could be implemented
-		if t == reflect.TypeOf((*sV)(nil)) {
-			*ptr = src.Interface().(*sV).sv
-			return true
+		return "", io.ErrNoProgress.Error()
+	}
+	write := func(data string) (int, string) {
+		if wr == nil {
+			return 0, "filehandle opened only for input"
 		}
-	case reflect.String:
-		str := src.String()
-		pl.enter()
-		C.glue_setPV(pl.thx, ptr, C.CString(str), C.STRLEN(len(str)))
-		pl.leave()
-		return true
-	case reflect.Struct:
-		ent := new(liveSTEnt)
-		liveMX.Lock()
-		liveSTSeq++
-		liveST[liveSTSeq] = ent
-		id := liveSTSeq
-		liveMX.Unlock()
-		nm := C.CString(t.PkgPath() + "/" + t.Name())
-		al := make([]*C.char, 1+t.NumField())
-		ent.getf = func(name *C.char) (rv *C.SV) {
-			// TODO: need an error proxy
-			pl.leave()
-			defer pl.enter()
-			pl.setSV(&rv, src.FieldByName(C.GoString(name)), errf)
-			return
+		n, err := io.WriteString(wr, data)
+		if err != nil {
+			return n, err.Error()
 		}
-		ent.setf = func(name *C.char, sv *C.SV) {
-			// TODO: need an error proxy
-			pl.leave()
-			defer pl.enter()
-			val := src.FieldByName(C.GoString(name))
-			pl.getSV(&val, sv, errf)
-		}
-		ent.call = func(name *C.char, arg **C.SV) (ret **C.SV) {
-			// TODO: need an error proxy
-			pl.leave()
-			defer pl.enter()
-			m := src.MethodByName(C.GoString(name))
-			mt := m.Type()
-			args := make([]reflect.Value, mt.NumIn())
-			for i, sv := range sliceOf(arg, len(args)) {
-				args[i] = reflect.New(mt.In(i)).Elem()
-				pl.getSV(&args[i], sv, errf)
-			}
-			ret = C.glue_alloc(C.IV(1 + mt.NumOut()))
-			rets := sliceOf(ret, 1+mt.NumOut())
-			for i, val := range m.Call(args) {
-				pl.setSV(&rets[i], val, errf)
-			}
-			return
+		return n, ""
+	}
+	cls := func() string {
+		if cl == nil {
+			return ""
 		}
-		ent.src = src
-		ent.live = len(al) /* held by the wrap + each field stub */
-		for i := range al[0 : len(al)-1] {
-			al[i] = C.CString(t.Field(i).Name)
+		if err := cl.Close(); err != nil {
+			return err.Error()
 		}
-		pl.enter()
-		C.glue_setObj(pl.thx, ptr, C.UV(id), nm, &al[0])
-		pl.leave()
-		return true
-	case reflect.UnsafePointer:
-	}
-	err := fmt.Errorf(`unhandled type "%s"`, src.Kind().String())
-	if errf(err) {
-		return false
+		return ""
 	}
-	panic(err)
+	return pl.newSVfh(read, write, cls)
 }
 
-func (pl *PL) getSV(dst *reflect.Value, src *C.SV, errf errFunc) bool {
-	t := dst.Type()
-	switch t.Kind() {
-	case reflect.Bool:
-		var val C.bool
-		pl.enter()
-		C.glue_getBool(pl.thx, &val, src)
-		pl.leave()
-		dst.SetBool(bool(val))
-		return true
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		var val C.IV
-		pl.enter()
-		C.glue_getIV(pl.thx, &val, src)
-		pl.leave()
-		dst.SetInt(int64(val))
-		return true
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-		var val C.UV
-		pl.enter()
-		C.glue_getUV(pl.thx, &val, src)
-		pl.leave()
-		dst.SetUint(uint64(val))
-		return true
-	case reflect.Float32, reflect.Float64:
-		var val C.NV
-		pl.enter()
-		C.glue_getNV(pl.thx, &val, src)
-		pl.leave()
-		dst.SetFloat(float64(val))
-		return true
-	case reflect.Complex64, reflect.Complex128:
-		if pl.valSVcmplx == nil {
-			pl.Eval(`
-				require Math::Complex;
-				sub {
-					return Math::Complex::Re($_[0]), Math::Complex::Im($_[0]);
-				}
-			`, &pl.valSVcmplx)
-		}
-		// TODO: check if errf to decide if callee should panic
-		re, im := pl.valSVcmplx(pl.sV(src, false))
-		dst.SetComplex(complex128(complex(re, im)))
-		return true
-	case reflect.Array:
-	case reflect.Chan:
-	case reflect.Func:
-		// Did this come from Go in the first place?
-		var id C.UV
-		var hasID C.bool
-		pl.enter()
-		hasID = C.glue_getId(pl.thx, src, &id, C.CString(t.Kind().String()))
-		pl.leave()
-		if bool(hasID) {
-			liveMX.RLock()
-			ent := liveCB[uint(id)]
-			liveMX.RUnlock()
-			dst.Set(ent.orig)
-			return true
+// perlFH is the Go side of a Perl filehandle
+type perlFH struct {
+	pl *PL
+	fh *sV
+}
+
+func (pl *PL) fhInit() {
+	if pl.fhRead != nil {
+		return
+	}
+	pl.evalTrusted(`
+		sub {
+			my($fh, $n) = @_;
+			my $rv = read $fh, my($buf), $n;
+			die "$!\n" unless defined $rv;
+			return $buf;
+		},
+		sub {
+			my($fh, $buf) = @_;
+			local $\;
+			print {$fh} $buf or die "$!\n";
+			return length $buf;
+		},
+		sub {
+			close $_[0] or die "$!\n";
+			return;
 		}
-		// if not, try to translate
-		cv := pl.sV(src, true)
-		dst.Set(reflect.MakeFunc(t, func(arg []reflect.Value) (outs []reflect.Value) {
-			// This ends up looking a lot like Eval(), but we have input
-			// args to convert and an SV instead of a string to execute.
-
-			// first scan outputs, so we can get error handling correct
-			// asap.
-			outs = make([]reflect.Value, t.NumOut())
-			for i := range outs {
-				outs[i] = reflect.New(t.Out(i)).Elem()
-			}
-			ret, errh := splitErrs(outs)
+	`, &pl.fhRead, &pl.fhWrite, &pl.fhClose)
+}
 
-			args := make([]*C.SV, 1+t.NumIn())
-			for i, val := range arg {
-				if !pl.setSV(&args[i], val, errh) {
-					return
-				}
-			}
+func (fh *perlFH) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if fh.pl.closed() {
+		return 0, ErrClosed
+	}
+	buf, err := fh.pl.fhRead(fh.pl.sV(fh.fh.sv, false), len(p))
+	if err != nil {
+		return 0, err
+	}
+	if len(buf) == 0 {
+		return 0, io.EOF
+	}
+	return copy(p, buf), nil
+}
 
-			rets := make([]*C.SV, 1+len(ret))
-
-			// make the call
-			no := C.UV(len(ret))
-			var esv *C.SV
-			pl.enter()
-			esv = C.glue_call_sv(pl.thx, cv.sv, &args[0], &rets[0], no)
-			pl.leave()
-			defer func() {
-				pl.enter()
-				for _, sv := range rets {
-					C.glue_dec(pl.thx, sv)
-				}
-				C.glue_dec(pl.thx, esv)
-				pl.leave()
-			}()
-			if esv != nil {
-				err := pl.sV(esv, true)
-				if errh(err) {
-					return
-				}
-				panic(err)
-			}
+func (fh *perlFH) Write(p []byte) (int, error) {
+	if fh.pl.closed() {
+		return 0, ErrClosed
+	}
+	return fh.pl.fhWrite(fh.pl.sV(fh.fh.sv, false), string(p))
+}
 
-			for i, v := range ret {
-				// try converting rvs
-				if !pl.getSV(&v, rets[i], errh) {
-					return
-				}
-			}
-			return
-		}))
-		return true
-	case reflect.Interface:
-		if t == reflect.TypeOf((*error)(nil)).Elem() {
-			dst.Set(reflect.ValueOf(pl.sV(src, true)))
-			return true
-		}
-	case reflect.Map:
-		cb := func(raw **C.SV, iv C.IV) {
-			pl.leave()
-			defer pl.enter()
-			n := int(iv)
-			if n >= 0 {
-				dst.Set(reflect.MakeMap(t))
-				var k reflect.Value
-				for i, sv := range sliceOf(raw, n) {
-					switch i & 1 {
-					case 0:
-						k = reflect.New(t.Key()).Elem()
-						if !pl.getSV(&k, sv, errf) {
-							return
-						}
-					case 1:
-						v := reflect.New(t.Elem()).Elem()
-						if !pl.getSV(&v, sv, errf) {
-							return
-						}
-						dst.SetMapIndex(k, v)
-					}
-				}
-			} else {
-				err := fmt.Errorf("unable to convert SV to Map")
-				if errf(err) {
-					return
-				}
-				panic(err)
-			}
-		}
-		ptr := C.UV(uintptr(unsafe.Pointer(&cb)))
-		pl.enter()
-		C.glue_walkHV(pl.thx, src, ptr)
-		pl.leave()
-		return true
-	case reflect.Ptr:
-		// TODO: for now we're only handling *plgo.sV wrapping
-		if t == reflect.TypeOf((*sV)(nil)) {
-			dst.Set(reflect.ValueOf(pl.sV(src, false)))
-			return true
-		}
-	case reflect.Slice:
-		var err error
-		errh := func(ev error) bool {
-			err = ev
-			return true
-		}
-		cb := func(raw **C.SV, iv C.IV) {
-			pl.leave()
-			defer pl.enter()
-			n := int(iv)
-			if n >= 0 {
-				dst.Set(reflect.MakeSlice(t, n, n))
-				for i, sv := range sliceOf(raw, n) {
-					val := dst.Index(i)
-					if !pl.getSV(&val, sv, errh) {
-						return
-					}
-				}
-			} else {
-				errh(fmt.Errorf("unable to convert SV to Slice"))
-				return
-			}
-		}
-		ptr := C.UV(uintptr(unsafe.Pointer(&cb)))
-		pl.enter()
-		C.glue_walkAV(pl.thx, src, ptr, true)
-		pl.leave()
-		if err != nil {
-			if errf(err) {
-				return false
-			}
-			panic(err)
-		}
-		return true
-	case reflect.String:
-		var str *C.char
-		var len C.STRLEN
-		pl.enter()
-		C.glue_getPV(pl.thx, &str, &len, src)
-		pl.leave()
-		dst.SetString(C.GoStringN(str, C.int(len)))
-		return true
-	case reflect.Struct:
-		// Did this come from Go in the first place?
-		var id C.UV
-		var hasID C.bool
-		pl.enter()
-		hasID = C.glue_getId(pl.thx, src, &id, C.CString(t.Kind().String()))
-		pl.leave()
-		if bool(hasID) {
-			liveMX.RLock()
-			ent := liveST[uint(id)]
-			liveMX.RUnlock()
-			dst.Set(ent.src)
-			return true
-		}
-		// if not, try to translate
-		var err error
-		errh := func(ev error) bool {
-			err = ev
-			return true
-		}
-		cb := func(raw **C.SV, n C.IV) {
-			pl.leave()
-			defer pl.enter()
-			dst.Set(reflect.New(t).Elem())
-			k := reflect.New(reflect.TypeOf((*string)(nil)).Elem()).Elem()
-			for i, sv := range sliceOf(raw, int(n)) {
-				switch i & 1 {
-				case 0:
-					if !pl.getSV(&k, sv, errh) {
-						return
-					}
-				case 1:
-					v := dst.FieldByName(k.String())
-					if v.IsValid() {
-						if !pl.getSV(&v, sv, errh) {
-							return
-						}
-					}
-				}
-			}
+func (fh *perlFH) Close() error {
+	if fh.pl.closed() {
+		return ErrClosed
+	}
+	return fh.pl.fhClose(fh.pl.sV(fh.fh.sv, false))
+}
+
+// perlErr converts an exception from a call made with ctx to a Go
+// error
+func (pl *PL) perlErr(ctx context.Context, sv *C.SV) error {
+	var code, kind C.IV
+	pl.enter()
+	kind = C.glue_errKind(pl.thx, sv, &code)
+	pl.leave()
+	switch kind {
+	case 1:
+		return &ExitError{int(code)}
+	case 2:
+		// an outer call's Context may be the one that fired, if so
+		// the exception needs to keep unwinding
+		if err := ctx.Err(); err != nil {
+			return err
 		}
-		ptr := C.UV(uintptr(unsafe.Pointer(&cb)))
-		pl.enter()
-		C.glue_walkHV(pl.thx, src, ptr)
-		pl.leave()
-		if err != nil {
-			if errf(err) {
-				return false
-			}
-			panic(err)
+	case 3:
+		if code == 1 {
+			return &LimitError{"ops", pl.budget[0]}
 		}
-		return true
-	case reflect.UnsafePointer:
+		return &LimitError{"live", pl.budget[1]}
 	}
-	err := fmt.Errorf(`unhandled type "%v"`, t.Kind().String())
-	if errf(err) {
-		return false
+	return pl.sV(sv, true)
+}
+
+// rethrow is deferred by Go callbacks.  Panics must not unwind through
+// the Perl runtime, so they are recovered and passed back to be raised
+// as Perl exceptions instead.
+func (pl *PL) rethrow(errp **C.SV) {
+	r := recover()
+	if r == nil {
+		return
 	}
-	panic(err)
+	pl.enter()
+	defer pl.leave()
+	switch err := r.(type) {
+	case *sV:
+		if err.pl == pl {
+			C.glue_inc(pl.thx, err.sv)
+			*errp = err.sv
+			return
+		}
+	case *ExitError:
+		C.glue_setExit(pl.thx, errp, C.IV(err.Code))
+		return
+	}
+	msg := fmt.Sprint(r)
+	C.glue_setPV(pl.thx, errp, C.CString(msg), C.STRLEN(len(msg)))
 }
 
 func svFini(sv *sV) {
-	if sv.own {
-		sv.pl.enter()
-		C.glue_dec(sv.pl.thx, sv.sv)
-		sv.pl.leave()
-	}
+	// once the PL is closed, the SV is already gone
+	sv.pl.exec(func() {
+		if sv.own && sv.pl.acquire() {
+			C.glue_dec(sv.pl.thx, sv.sv)
+			sv.pl.leave()
+		}
+	})
 }
 
 func (pl *PL) sV(sv *C.SV, own bool) *sV {
@@ -656,18 +1335,33 @@ func (pl *PL) sV(sv *C.SV, own bool) *sV {
 	self.pl = pl
 	self.sv = sv
 	self.own = own
-	pl.enter()
-	C.glue_inc(pl.thx, sv)
-	pl.leave()
+	pl.exec(func() {
+		pl.enter()
+		C.glue_inc(pl.thx, sv)
+		pl.leave()
+	})
 	runtime.SetFinalizer(&self, svFini)
 	return &self
 }
 
+// wrap is sV() for when the PL is already entered
+func (pl *PL) wrap(sv *C.SV, own bool) *sV {
+	self := &sV{pl, sv, own}
+	C.glue_inc(pl.thx, sv)
+	runtime.SetFinalizer(self, svFini)
+	return self
+}
+
 func (sv *sV) Error() string {
+	if sv.pl.closed() {
+		return ErrClosed.Error()
+	}
 	v := reflect.New(reflect.TypeOf((*string)(nil)).Elem()).Elem()
-	sv.pl.getSV(&v, sv.sv, func(err error) bool {
-		// TODO: getSV can return an error, handle it *somehow*
-		return false
+	sv.pl.exec(func() {
+		sv.pl.getSV(&v, sv.sv, func(err error) bool {
+			// TODO: getSV can return an error, handle it *somehow*
+			return false
+		})
 	})
 	return v.String()
 }
@@ -678,50 +1372,68 @@ func goList(cb uintptr, lst **C.SV, n C.IV) {
 }
 
 //export goInvoke
-func goInvoke(data uint, arg **C.SV) **C.SV {
-	liveMX.RLock()
-	ent := liveCB[data]
-	liveMX.RUnlock()
-	return ent.call(arg)
+func goInvoke(thx *C.PerlInterpreter, data uint, arg **C.SV, errp **C.SV) **C.SV {
+	pl := plOf(thx)
+	pl.liveMX.RLock()
+	ent := pl.liveCB[data]
+	pl.liveMX.RUnlock()
+	return ent.call(pl, arg, errp)
+}
+
+//export goDupCB
+func goDupCB(proto *C.PerlInterpreter, data uint) {
+	cl := plOf(proto).cloning
+	cl.liveCB[data].live++
 }
 
 //export goReleaseCB
-func goReleaseCB(data uint) {
-	liveMX.Lock()
-	delete(liveCB, data)
-	liveMX.Unlock()
+func goReleaseCB(thx *C.PerlInterpreter, data uint) {
+	pl := plOf(thx)
+	pl.liveMX.Lock()
+	pl.liveCB[data].live--
+	if pl.liveCB[data].live <= 0 {
+		delete(pl.liveCB, data)
+	}
+	pl.liveMX.Unlock()
+}
+
+func (pl *PL) liveSTEnt(id uint) *liveSTEnt {
+	pl.liveMX.RLock()
+	defer pl.liveMX.RUnlock()
+	return pl.liveST[id]
 }
 
 //export goSTGetf
-func goSTGetf(id uint, name *C.char) *C.SV {
-	liveMX.RLock()
-	ent := liveST[id]
-	liveMX.RUnlock()
-	return ent.getf(name)
+func goSTGetf(thx *C.PerlInterpreter, id uint, name *C.char) *C.SV {
+	pl := plOf(thx)
+	return pl.liveSTEnt(id).getf(pl, name)
 }
 
 //export goSTSetf
-func goSTSetf(id uint, name *C.char, sv *C.SV) {
-	liveMX.RLock()
-	ent := liveST[id]
-	liveMX.RUnlock()
-	ent.setf(name, sv)
+func goSTSetf(thx *C.PerlInterpreter, id uint, name *C.char, sv *C.SV) {
+	pl := plOf(thx)
+	pl.liveSTEnt(id).setf(pl, name, sv)
 }
 
 //export goSTCall
-func goSTCall(id uint, name *C.char, arg **C.SV) **C.SV {
-	liveMX.RLock()
-	ent := liveST[id]
-	liveMX.RUnlock()
-	return ent.call(name, arg)
+func goSTCall(thx *C.PerlInterpreter, id uint, name *C.char, arg **C.SV, errp **C.SV) **C.SV {
+	pl := plOf(thx)
+	return pl.liveSTEnt(id).call(pl, name, arg, errp)
+}
+
+//export goDupST
+func goDupST(proto *C.PerlInterpreter, id uint) {
+	cl := plOf(proto).cloning
+	cl.liveST[id].live++
 }
 
 //export goReleaseST
-func goReleaseST(id uint) {
-	liveMX.Lock()
-	liveST[id].live--
-	if liveST[id].live <= 0 {
-		delete(liveST, id)
+func goReleaseST(thx *C.PerlInterpreter, id uint) {
+	pl := plOf(thx)
+	pl.liveMX.Lock()
+	pl.liveST[id].live--
+	if pl.liveST[id].live <= 0 {
+		delete(pl.liveST, id)
 	}
-	liveMX.Unlock()
+	pl.liveMX.Unlock()
 }
@@ -0,0 +1,85 @@
+package plgo
+
+// #include "glue.h"
+import "C"
+import (
+	"context"
+	"reflect"
+)
+
+// List collects every remaining value of a Perl list.  As a result of
+// Eval() or of a bound func it also puts the call in list context, so
+//
+//	var now func() plgo.List[int]
+//	pl.Eval(`sub { localtime }`, &now)
+//
+// gets all nine fields rather than the string scalar localtime gives.
+// A Go callback returning a List hands Perl its elements as a list.
+type List[T any] []T
+
+func (List[T]) list() {}
+
+type lister interface{ list() }
+
+var listType = reflect.TypeOf((*lister)(nil)).Elem()
+
+// decodeList fills in dst, a List, from lst.
+func (pl *PL) decodeList(dst *reflect.Value, lst []*C.SV, errf errFunc) bool {
+	dst.Set(reflect.MakeSlice(dst.Type(), len(lst), len(lst)))
+	for i, sv := range lst {
+		e := dst.Index(i)
+		if !pl.decode(&e, sv, errf) {
+			return false
+		}
+	}
+	return true
+}
+
+// Want is the context Perl called a Go callback in, as wantarray would
+// report it.
+type Want int
+
+const (
+	WantVoid Want = iota
+	WantScalar
+	WantList
+)
+
+type wantKey struct{}
+
+// WantOf reports the calling context from the Context handed to a Go
+// callback that asks for one.  Other Contexts report WantScalar.
+func WantOf(ctx context.Context) Want {
+	if w, ok := ctx.Value(wantKey{}).(Want); ok {
+		return w
+	}
+	return WantScalar
+}
+
+// encodeList converts the results of a Go callback into a new NULL
+// terminated array, spreading out the elements of any List.
+func (pl *PL) encodeList(outs []*codec, vals []reflect.Value, errf errFunc) **C.SV {
+	n := 0
+	for _, val := range vals {
+		if val.Type().Implements(listType) {
+			n += val.Len()
+		} else {
+			n++
+		}
+	}
+	ret := C.glue_alloc(C.IV(1 + n))
+	rets := sliceOf(ret, n)
+	j := 0
+	for i, val := range vals {
+		if !val.Type().Implements(listType) {
+			outs[i].enc(pl, &rets[j], val, errf)
+			j++
+			continue
+		}
+		for k := 0; k < val.Len(); k++ {
+			outs[i].enc(pl, &rets[j], val.Index(k), errf)
+			j++
+		}
+	}
+	return ret
+}
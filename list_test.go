@@ -0,0 +1,91 @@
+package plgo_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tlby/plgo"
+)
+
+func TestWant(t *testing.T) {
+	pl := plgo.New()
+	defer pl.Close()
+
+	// Eval context
+	var s string
+	var lt plgo.List[int]
+	pl.EvalScalar(`gmtime(0)`, &s)
+	pl.Eval(`gmtime(0)`, &lt)
+	if s != "Thu Jan  1 00:00:00 1970" || len(lt) != 9 || lt[5] != 70 {
+		t.Errorf("gmtime => %q, %v", s, lt)
+	}
+	var n int
+	var rest plgo.List[string]
+	pl.Eval(`1, "a", "b"`, &n, &rest)
+	if n != 1 || strings.Join(rest, "") != "ab" {
+		t.Errorf("rest => %v, %q", n, rest)
+	}
+	pl.Eval(`2`, &n, &rest)
+	if n != 2 || len(rest) != 0 {
+		t.Errorf("rest => %v, %q", n, rest)
+	}
+	pl.EvalScalar(`my @a = (7, 8, 9); @a`, &n)
+	if n != 3 {
+		t.Errorf("EvalScalar(@a) => %v", n)
+	}
+
+	// bound funcs
+	var count func() int
+	var all func() (plgo.List[int], error)
+	var head func() (int, plgo.List[int])
+	var two func() (int, int)
+	pl.Eval(`sub { my @a = (7, 8, 9); @a }`, &count)
+	pl.Eval(`sub { my @a = (7, 8, 9); @a }`, &all)
+	pl.Eval(`sub { my @a = (7, 8, 9); @a }`, &head)
+	pl.Eval(`sub { 1 }`, &two)
+	if v := count(); v != 3 {
+		t.Errorf("count() => %v", v)
+	}
+	if v, err := all(); err != nil || len(v) != 3 || v[2] != 9 {
+		t.Errorf("all() => %v, %v", v, err)
+	}
+	if h, r := head(); h != 7 || len(r) != 2 || r[0] != 8 {
+		t.Errorf("head() => %v, %v", h, r)
+	}
+	if a, b := two(); a != 1 || b != 0 {
+		t.Errorf("two() => %v, %v", a, b)
+	}
+
+	// Go callbacks see their context and can return a List
+	want := func(ctx context.Context) plgo.List[string] {
+		switch plgo.WantOf(ctx) {
+		case plgo.WantVoid:
+			pl.Eval(`our $void = 1`)
+			return nil
+		case plgo.WantScalar:
+			return plgo.List[string]{"scalar"}
+		}
+		return plgo.List[string]{"list", "of", "words"}
+	}
+	var try func(func(context.Context) plgo.List[string]) string
+	pl.Eval(`sub { my $f = shift; my @l = $f->(); my $s = $f->(); $f->(); our $void ? "@l/$s" : "" }`, &try)
+	if v := try(want); v != "list of words/scalar" {
+		t.Errorf("try() => %q", v)
+	}
+	// more results than the args left stack room for
+	var sum func(func() plgo.List[int]) int
+	pl.Eval(`sub { my $t = 0; $t += $_ for $_[0]->(); $t }`, &sum)
+	if v := sum(func() plgo.List[int] {
+		l := make(plgo.List[int], 200000)
+		for i := range l {
+			l[i] = 1
+		}
+		return l
+	}); v != 200000 {
+		t.Errorf("sum() => %v", v)
+	}
+	if plgo.WantOf(context.Background()) != plgo.WantScalar {
+		t.Errorf("WantOf(Background)")
+	}
+}
@@ -0,0 +1,220 @@
+package plgo
+
+// #include "glue.h"
+import "C"
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// loop holds the timers and I/O watchers Perl code sets up with
+// Go::Loop, RunLoop() calls them back as they fire.
+type loop struct {
+	mx    sync.Mutex // guards seq and watch
+	seq   int
+	watch map[int]*watcher
+	fired chan *watcher
+	kick  chan struct{} // a watcher was cancelled
+	done  chan struct{} // closed with the PL
+}
+
+type watcher struct {
+	id    int
+	cb    func(context.Context) error
+	every time.Duration // repeat interval of a timer
+	timer *time.Timer
+	io    bool
+	ack   chan struct{} // an I/O callback has run
+	stop  chan struct{} // closed on cancel
+	wake  *os.File      // wakes the poll of a cancelled I/O watcher
+}
+
+// loopInit sets up the loop state and installs the Go::Loop hooks, the
+// hooks close over pl so a Clone() needs its own.
+func (pl *PL) loopInit() {
+	lp := &loop{
+		watch: make(map[int]*watcher),
+		fired: make(chan *watcher),
+		kick:  make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+	pl.loop = lp
+	timer := func(secs float64, repeat bool, cb func(context.Context) error) int {
+		d := time.Duration(secs * float64(time.Second))
+		w := &watcher{cb: cb, stop: make(chan struct{})}
+		if repeat {
+			w.every = d
+		}
+		lp.mx.Lock()
+		defer lp.mx.Unlock()
+		lp.add(w)
+		w.timer = time.AfterFunc(d, func() { lp.fire(w) })
+		return w.id
+	}
+	io := func(fd int, write bool, cb func(context.Context) error) int {
+		rd, wr, err := os.Pipe()
+		if err != nil {
+			panic(err)
+		}
+		w := &watcher{
+			cb:   cb,
+			io:   true,
+			ack:  make(chan struct{}, 1),
+			stop: make(chan struct{}),
+			wake: wr,
+		}
+		lp.mx.Lock()
+		lp.add(w)
+		lp.mx.Unlock()
+		go lp.poll(w, fd, write, rd)
+		return w.id
+	}
+	cancel := func(id int) bool {
+		lp.mx.Lock()
+		defer lp.mx.Unlock()
+		return lp.remove(lp.watch[id])
+	}
+	var install func(interface{}, interface{}, interface{})
+	pl.evalTrusted(`sub { ($Go::Loop::timer, $Go::Loop::io, $Go::Loop::cancel) = @_; return }`, &install)
+	install(timer, io, cancel)
+}
+
+// add registers w, lp.mx must be held
+func (lp *loop) add(w *watcher) {
+	lp.seq++
+	w.id = lp.seq
+	lp.watch[w.id] = w
+}
+
+// remove stops w, lp.mx must be held.  It reports if w was active.
+func (lp *loop) remove(w *watcher) bool {
+	if w == nil || lp.watch[w.id] != w {
+		return false
+	}
+	delete(lp.watch, w.id)
+	close(w.stop)
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	if w.wake != nil {
+		w.wake.Close()
+	}
+	select {
+	case lp.kick <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// fire hands w to RunLoop(), it reports false if w stopped first
+func (lp *loop) fire(w *watcher) bool {
+	select {
+	case lp.fired <- w:
+		return true
+	case <-w.stop:
+	case <-lp.done:
+	}
+	return false
+}
+
+// poll fires w each time fd is ready, once the callback has run it
+// waits again.
+func (lp *loop) poll(w *watcher, fd int, write bool, wake *os.File) {
+	defer wake.Close()
+	for {
+		switch C.glue_poll(C.int(fd), C.bool(write), C.int(wake.Fd())) {
+		case 0:
+			return
+		case -1:
+			// nothing more will come of it
+			lp.mx.Lock()
+			lp.remove(w)
+			lp.mx.Unlock()
+			return
+		}
+		if !lp.fire(w) {
+			return
+		}
+		select {
+		case <-w.ack:
+		case <-w.stop:
+			return
+		case <-lp.done:
+			return
+		}
+	}
+}
+
+// close stops every watcher
+func (lp *loop) close() {
+	lp.mx.Lock()
+	defer lp.mx.Unlock()
+	for _, w := range lp.watch {
+		lp.remove(w)
+	}
+	close(lp.done)
+}
+
+// RunLoop calls back the timers and I/O watchers set up by Perl code
+// with Go::Loop, e.g.
+//
+//	use Go::Loop;
+//	my $t = every(5, sub { ... });
+//	after(60, sub { cancel($t) });
+//
+// until none are left or ctx is done.  Callbacks run with ctx, and
+// between them the interpreter is free for other calls.  If a callback
+// dies, RunLoop returns the error.
+func (pl *PL) RunLoop(ctx context.Context) error {
+	lp := pl.loop
+	for {
+		if pl.closed() {
+			return ErrClosed
+		}
+		lp.mx.Lock()
+		n := len(lp.watch)
+		lp.mx.Unlock()
+		if n == 0 {
+			return nil
+		}
+		select {
+		case w := <-lp.fired:
+			if err := lp.call(ctx, w); err != nil {
+				return err
+			}
+		case <-lp.kick:
+		case <-lp.done:
+			return ErrClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (lp *loop) call(ctx context.Context, w *watcher) error {
+	lp.mx.Lock()
+	if lp.watch[w.id] != w {
+		// cancelled since it fired
+		lp.mx.Unlock()
+		return nil
+	}
+	if !w.io && w.every == 0 {
+		lp.remove(w)
+	}
+	lp.mx.Unlock()
+	err := w.cb(ctx)
+	lp.mx.Lock()
+	if lp.watch[w.id] == w {
+		if w.io {
+			w.ack <- struct{}{}
+		} else {
+			// the interval counts from when the callback is done,
+			// so slow callbacks can't pile up
+			w.timer.Reset(w.every)
+		}
+	}
+	lp.mx.Unlock()
+	return err
+}
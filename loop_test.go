@@ -0,0 +1,94 @@
+package plgo_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tlby/plgo"
+)
+
+func TestLoop(t *testing.T) {
+	pl := plgo.New()
+	defer pl.Close()
+	ctx := context.Background()
+
+	// nothing to wait for
+	if err := pl.RunLoop(ctx); err != nil {
+		t.Errorf("RunLoop() => %v", err)
+	}
+
+	pl.Eval(`
+		use Go::Loop;
+		our @log;
+		my($n, $t) = (0);
+		$t = every(0.01, sub { push @log, "tick"; cancel($t) if ++$n == 3 });
+		after(0.1, sub { push @log, "after" });
+		cancel(after(0.01, sub { push @log, "cancelled" }));
+	`)
+	if err := pl.RunLoop(ctx); err != nil {
+		t.Errorf("RunLoop() => %v", err)
+	}
+	var log []string
+	pl.Eval(`\@log`, &log)
+	if strings.Join(log, " ") != "tick tick tick after" {
+		t.Errorf("@log => %q", log)
+	}
+
+	// I/O readiness
+	rd, wr, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+	defer wr.Close()
+	var watch func(int)
+	pl.Eval(`sub {
+		open my $fh, '<&=', $_[0] or die $!;
+		my $w; $w = Go::Loop::io($fh, 'r', sub {
+			sysread $fh, my($buf), 100;
+			push @log, $buf;
+			Go::Loop::cancel($w) if $buf =~ /end/;
+		});
+	}`, &watch)
+	watch(int(rd.Fd()))
+	go func() {
+		for _, msg := range []string{"one", "two", "end"} {
+			time.Sleep(10 * time.Millisecond)
+			wr.WriteString(msg)
+		}
+	}()
+	if err := pl.RunLoop(ctx); err != nil {
+		t.Errorf("RunLoop() => %v", err)
+	}
+	pl.Eval(`\@log`, &log)
+	if strings.Join(log[4:], " ") != "one two end" {
+		t.Errorf("@log => %q", log)
+	}
+
+	// the loop leaves the interpreter free between callbacks
+	pl.Eval(`Go::Loop::every(0.01, sub { })`)
+	tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	go pl.Eval(`push @log, "other"`)
+	if err := pl.RunLoop(tctx); err != context.DeadlineExceeded {
+		t.Errorf("RunLoop() => %v", err)
+	}
+	pl.Eval(`\@log`, &log)
+	if log[len(log)-1] != "other" {
+		t.Errorf("@log => %q", log)
+	}
+
+	// errors end the loop
+	pl.Eval(`Go::Loop::after(0, sub { die "oops\n" })`)
+	if err := pl.RunLoop(ctx); err == nil || err.Error() != "oops\n" {
+		t.Errorf("RunLoop() => %v", err)
+	}
+	var err2 error
+	pl.Eval(`Go::Loop::every(0, sub { })`, &err2)
+	if err2 == nil {
+		t.Errorf("every(0) should fail")
+	}
+}
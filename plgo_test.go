@@ -1,12 +1,22 @@
 package plgo_test
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"github.com/tlby/plgo"
+	"io"
 	"math"
 	"math/cmplx"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 )
 
 type AList []int
@@ -22,6 +32,13 @@ func (ast AStruct) AMethod(n int) int {
 	return ast.I + n
 }
 
+func (ast AStruct) ASum(n ...int) int {
+	for _, v := range n {
+		ast.I += v
+	}
+	return ast.I
+}
+
 var pl = plgo.New()
 
 func ExamplePL_Eval() {
@@ -58,6 +75,108 @@ func ExamplePL_Eval() {
 	// too short at plgo.Eval() line 2.
 }
 
+func TestOptions(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "Vendored.pm"), []byte(`
+		package Vendored;
+		sub import { $Vendored::imported = "@_[1 .. $#_]" }
+		sub bye { exit 4 }
+		1;
+	`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := plgo.NewWithOptions(plgo.Options{
+		Inc:      []string{dir},
+		Modules:  []string{"Vendored=a,b"},
+		Warnings: true,
+		Args:     []string{"x", "y z"},
+		Script:   "rules.pl",
+		Env:      []string{"PLGO_A=1", "PLGO_B=two=2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inc, mod, args, script, env string
+	var warn bool
+	p.Eval(`$ENV{PLGO_C} = 3; (
+		$INC[0], $Vendored::imported, join('|', @ARGV), $0,
+		join('|', map "$_=$ENV{$_}", sort keys %ENV), $^W
+	)`, &inc, &mod, &args, &script, &env, &warn)
+	if inc != dir || mod != "a b" || args != "x|y z" || script != "rules.pl" ||
+		env != "PLGO_A=1|PLGO_B=two=2|PLGO_C=3" || !warn {
+		t.Errorf("options => %q, %q, %q, %q, %q, %v",
+			inc, mod, args, script, env, warn)
+	}
+	if os.Getenv("PLGO_C") != "" {
+		t.Errorf("isolated %%ENV leaked to the process")
+	}
+	// exit() in a module loaded at startup doesn't end the process
+	p.Eval(`Vendored::bye()`, &err)
+	if e, ok := err.(*plgo.ExitError); !ok || e.Code != 4 {
+		t.Errorf("Vendored::bye() => %#v", err)
+	}
+
+	// nor does one while it loads, and eval {} can't stop it there
+	err = os.WriteFile(filepath.Join(dir, "Exiter.pm"), []byte(`
+		package Exiter;
+		eval { exit 3 };
+		die "still loading\n";
+	`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = plgo.NewWithOptions(plgo.Options{Inc: []string{dir}, Modules: []string{"Exiter"}})
+	if e, ok := err.(*plgo.ExitError); !ok || e.Code != 3 {
+		t.Errorf("NewWithOptions(Exiter) => %#v", err)
+	}
+
+	for _, opts := range []plgo.Options{
+		{Inc: []string{""}},
+		{Modules: []string{"Not A Module"}},
+		{Modules: []string{"No::Such::Module"}},
+		{Env: []string{"=oops"}},
+		{Args: []string{"a\x00b"}},
+	} {
+		if _, err := plgo.NewWithOptions(opts); err == nil {
+			t.Errorf("NewWithOptions(%#v) error expected", opts)
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	p := plgo.New()
+	var fn func() error
+	var set func(func())
+	p.Eval(`(sub { 1 }, sub { ($main::cb) = @_ })`, &fn, &set)
+	p.Eval(`END { $main::cb->() }`)
+	ended := false
+	set(func() { ended = true })
+	if err := p.Close(); err != nil {
+		t.Errorf("Close() => %v", err)
+	}
+	if !ended {
+		t.Errorf("END block did not run")
+	}
+	if err := fn(); err != plgo.ErrClosed {
+		t.Errorf("call after Close() => %v", err)
+	}
+	var err error
+	p.Eval(`1`, &err)
+	if err != plgo.ErrClosed {
+		t.Errorf("Eval() after Close() => %v", err)
+	}
+	if p.Close() != plgo.ErrClosed {
+		t.Errorf("second Close() should fail")
+	}
+
+	p = plgo.New()
+	p.Eval(`END { $? = 3 }`)
+	if err := p.Close(); err == nil {
+		t.Errorf("Close() error expected")
+	}
+}
+
 func leak(t *testing.T, n int, obj interface{}, txt string) {
 	var inFn, rvFn func()
 	body := fmt.Sprintf(`(sub {}, sub {%s})`, txt)
@@ -197,6 +316,19 @@ func TestErr(t *testing.T) {
 		t.Errorf("perl error expected")
 	}
 
+	// a Perl error can be handed back to Perl and outlive it there
+	var show func(error, interface{}) string
+	pl.Eval(`sub { "$_[0]/$_[1]" }`, &show)
+	for i := 0; i < 100; i++ {
+		if v := show(err, err); v != "tippy out\n/tippy out\n" {
+			t.Errorf("show(err) => %q", v)
+		}
+		runtime.GC()
+	}
+	if err.Error() != "tippy out\n" {
+		t.Errorf("err => %q", err.Error())
+	}
+
 	// if they do not and we hit a perl exception, then we'll panic.
 	var g func() int
 	pl.Eval(`sub { die "tippy up\n" }`, &g)
@@ -222,6 +354,519 @@ func TestErr(t *testing.T) {
 	}
 }
 
+func TestExit(t *testing.T) {
+	var err error
+	pl.Eval(`exit 3`, &err)
+	if e, ok := err.(*plgo.ExitError); !ok || e.Code != 3 {
+		t.Errorf("exit 3 => %#v", err)
+	}
+
+	// eval {} can't catch it
+	pl.Eval(`eval { exit 3 }; 5`, &err)
+	if e, ok := err.(*plgo.ExitError); !ok || e.Code != 3 {
+		t.Errorf("eval { exit 3 } => %#v", err)
+	}
+
+	// exit() unwinds through Go callbacks
+	var outer func(func()) error
+	var inner func()
+	pl.Eval(`(sub { $_[0]->(); return }, sub { exit })`, &outer, &inner)
+	err = outer(inner)
+	if e, ok := err.(*plgo.ExitError); !ok || e.Code != 0 {
+		t.Errorf("nested exit => %#v", err)
+	}
+
+	// as do Go panics
+	err = outer(func() { panic("boom") })
+	if err == nil || !strings.HasPrefix(err.Error(), "boom") {
+		t.Errorf("panic => %v", err)
+	}
+
+	// and the interpreter survives all that
+	var v int
+	pl.Eval(`7`, &v)
+	if v != 7 {
+		t.Errorf("Eval() after exit => %v", v)
+	}
+}
+
+type ctxKey struct{}
+
+func TestContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var err error
+	// eval {} blocks do not get to swallow the interrupt
+	pl.EvalContext(ctx, `1 while 1; eval { 1 while 1 } while 1`, &err)
+	if err != context.DeadlineExceeded {
+		t.Errorf("EvalContext() => %v", err)
+	}
+
+	var spin func(context.Context) error
+	pl.Eval(`sub { 1 while 1 }`, &spin)
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if err = spin(ctx); err != context.Canceled {
+		t.Errorf("spin() => %v", err)
+	}
+	if err = spin(ctx); err != context.Canceled {
+		t.Errorf("spin() after cancel => %v", err)
+	}
+
+	// Go callbacks can pick up the Context of the call
+	var call func(context.Context, func(context.Context) string) string
+	pl.Eval(`sub { $_[0]->() }`, &call)
+	ctx = context.WithValue(context.Background(), ctxKey{}, "hi")
+	have := call(ctx, func(ctx context.Context) string {
+		return ctx.Value(ctxKey{}).(string)
+	})
+	if have != "hi" {
+		t.Errorf("ctx.Value() => %q", have)
+	}
+
+	var v int
+	pl.Eval(`7`, &v)
+	if v != 7 {
+		t.Errorf("Eval() after cancel => %v", v)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	pl := plgo.New()
+	defer pl.Close()
+	pl.MaxOps = 100000
+	var err error
+	pl.Eval(`1 while 1`, &err)
+	if le, ok := err.(*plgo.LimitError); !ok || le.Resource != "ops" || le.Limit != 100000 {
+		t.Errorf("Eval() with MaxOps => %v", err)
+	}
+	// eval {} blocks do not get to swallow the error either
+	pl.Eval(`eval { 1 while 1 } while 1`, &err)
+	if _, ok := err.(*plgo.LimitError); !ok {
+		t.Errorf("Eval() with eval {} => %v", err)
+	}
+	var v int
+	if pl.Eval(`my $n = 0; $n++ for 1 .. 100; $n`, &v, &err); err != nil || v != 100 {
+		t.Errorf("Eval() under MaxOps => %v, %v", v, err)
+	}
+	pl.MaxOps = 0
+
+	pl.MaxLive = pl.Live() + 10000
+	pl.Eval(`push our @keep, [] while 1`, &err)
+	if le, ok := err.(*plgo.LimitError); !ok || le.Resource != "live" {
+		t.Errorf("Eval() with MaxLive => %v", err)
+	}
+	pl.MaxLive = 0
+	if pl.Eval(`@keep = (); 7`, &v, &err); err != nil || v != 7 {
+		t.Errorf("Eval() after limits => %v, %v", v, err)
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	pl, err := plgo.NewWithOptions(plgo.Options{
+		Sandbox: &plgo.Sandbox{
+			Allow: []string{"sort"},
+			Funcs: map[string]interface{}{
+				"double":    func(v int) int { return 2 * v },
+				"Rules::ok": func() bool { return true },
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewWithOptions() => %v", err)
+	}
+	defer pl.Close()
+	var v int
+	for _, code := range []string{
+		`system "true"`,
+		"`true`",
+		`open my $fh, "-|", "true"`,
+		`fork`,
+		`require Data::Dumper`,
+		`socket my $s, 2, 1, 0`,
+		`print "hi"`,
+	} {
+		pl.Eval(code, &err)
+		if err == nil || !strings.Contains(err.Error(), "trapped by operation mask") {
+			t.Errorf("Eval(%s) => %v", code, err)
+		}
+	}
+	if pl.Eval(`double((sort { $a <=> $b } 3, 21)[1])`, &v, &err); err != nil || v != 42 {
+		t.Errorf("Eval() funcs => %v, %v", v, err)
+	}
+	var ok bool
+	if pl.Eval(`Rules::ok()`, &ok, &err); err != nil || !ok {
+		t.Errorf("Eval() qualified func => %v, %v", ok, err)
+	}
+	// plgo's own helpers keep working, even with require hooked, and
+	// the hooks don't get to run while the mask is lifted for them
+	pl.Eval(`
+		our $hooked = 0;
+		*CORE::GLOBAL::require = sub { $hooked++ };
+		*CORE::GLOBAL::do = sub { $hooked++ };
+		my @src = ("open my \$f, '<', '/dev/null';", "\$main::hooked += 10;", "1;");
+		unshift @INC, sub { $hooked++; sub { $_ = shift @src; defined $_ } };
+	`, &err)
+	if err != nil {
+		t.Errorf("Eval(hooks) => %v", err)
+	}
+	var cmplx func(complex128) complex128
+	pl.Eval(`sub { $_[0] * 2 }`, &cmplx)
+	if have := cmplx(1 + 2i); have != 2+4i {
+		t.Errorf("cmplx() => %v", have)
+	}
+	if pl.Eval(`our $hooked`, &v); v != 0 {
+		t.Errorf("require hooks ran %d times", v)
+	}
+	// nor if the helper's module has to be found again
+	pl2, _ := plgo.NewWithOptions(plgo.Options{Sandbox: &plgo.Sandbox{}})
+	defer pl2.Close()
+	pl2.Eval(`our $hooked = 0; unshift @INC, sub { $hooked++; return }; delete $INC{"Math/Complex.pm"}`)
+	pl2.Eval(`sub { $_[0] }`, &cmplx)
+	if errOf(func() { cmplx(1) }) == nil {
+		t.Errorf("cmplx() without Math::Complex should fail")
+	}
+	if pl2.Eval(`our $hooked`, &v); v != 0 {
+		t.Errorf("@INC hook ran %d times", v)
+	}
+
+	for _, sb := range []*plgo.Sandbox{
+		{Allow: []string{"nosuchop"}},
+		{Funcs: map[string]interface{}{"bad name": func() {}}},
+		{Funcs: map[string]interface{}{"notfunc": 7}},
+	} {
+		if _, err := plgo.NewWithOptions(plgo.Options{Sandbox: sb}); err == nil {
+			t.Errorf("NewWithOptions(%v) should fail", sb)
+		}
+	}
+}
+
+func TestExec(t *testing.T) {
+	var stdout bytes.Buffer
+	pl, err := plgo.NewWithOptions(plgo.Options{
+		Env:  []string{"GREETING=hi"},
+		Exec: &plgo.Exec{Stdout: &stdout},
+	})
+	if err != nil {
+		t.Fatalf("NewWithOptions() => %v", err)
+	}
+	defer pl.Close()
+	var status int
+	var out string
+	pl.Eval(`system "echo $ENV{GREETING}"; $?`, &status)
+	if status != 0 || stdout.String() != "hi\n" {
+		t.Errorf("system() => %d, %q", status, stdout.String())
+	}
+	pl.Eval(`system "sh", "-c", "exit 3"; $?`, &status)
+	if status != 3<<8 {
+		t.Errorf("system() exit 3 => %d", status)
+	}
+	pl.Eval(`$ENV{GREETING} = "hello"; qx(echo $ENV{GREETING} | tr h j)`, &out)
+	if out != "jello\n" {
+		t.Errorf("qx() => %q", out)
+	}
+	var lines []string
+	pl.Eval(`[ qx(printf "a\\nb\\n") ]`, &lines)
+	if len(lines) != 2 || lines[1] != "b\n" {
+		t.Errorf("qx() in list context => %q", lines)
+	}
+	pl.Eval(`system("/nonexistent") == -1 && $!{ENOENT} ? 1 : 0`, &status)
+	if status != 1 {
+		t.Errorf("system() of a missing command => %d", status)
+	}
+	pl.Eval(`exec "sh", "-c", "exit 5"`, &err)
+	if ee, ok := err.(*plgo.ExitError); !ok || ee.Code != 5 {
+		t.Errorf("exec() => %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	pl.EvalContext(ctx, `system "sleep", "10"`, &err)
+	if err != context.DeadlineExceeded || time.Since(start) > 5*time.Second {
+		t.Errorf("system() with a Context => %v", err)
+	}
+
+	pl, err = plgo.NewWithOptions(plgo.Options{
+		Exec: &plgo.Exec{Allow: []string{"true"}},
+	})
+	if err != nil {
+		t.Fatalf("NewWithOptions() => %v", err)
+	}
+	defer pl.Close()
+	pl.Eval(`system("true") == 0 && system("false") == -1 && $!{EACCES} ? 1 : 0`, &status)
+	if status != 1 {
+		t.Errorf("system() with Allow => %d", status)
+	}
+
+	// a Sandbox still rules out what it doesn't allow
+	pl, err = plgo.NewWithOptions(plgo.Options{
+		Exec:    &plgo.Exec{},
+		Sandbox: &plgo.Sandbox{Allow: []string{"system"}},
+	})
+	if err != nil {
+		t.Fatalf("NewWithOptions() => %v", err)
+	}
+	defer pl.Close()
+	pl.Eval(`system("true")`, &status, &err)
+	if err != nil || status != 0 {
+		t.Errorf("sandboxed system() => %d, %v", status, err)
+	}
+	for _, code := range []string{
+		"qx(true)",
+		"exec('true')",
+		"CORE::GLOBAL::exec('true')",
+	} {
+		err = nil
+		pl.Eval(code, &err)
+		if err == nil {
+			t.Errorf("sandboxed %s should fail", code)
+		}
+	}
+	pl, err = plgo.NewWithOptions(plgo.Options{
+		Exec:    &plgo.Exec{},
+		Sandbox: &plgo.Sandbox{},
+	})
+	if err != nil {
+		t.Fatalf("NewWithOptions() => %v", err)
+	}
+	defer pl.Close()
+	for _, code := range []string{
+		"system('true')",
+		"CORE::GLOBAL::system('true')",
+	} {
+		err = nil
+		pl.Eval(code, &err)
+		if err == nil {
+			t.Errorf("sandboxed %s should fail", code)
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	orig := plgo.New()
+	var keep func(func(int) int, AStruct)
+	orig.Eval(`our $x = 5; sub { our($cb, $st) = @_ }`, &keep)
+	keep(func(v int) int { return 2 * v }, AStruct{I: 4, F: 5.6})
+
+	pl, err := orig.Clone()
+	if err != nil {
+		t.Fatalf("Clone() => %v", err)
+	}
+	defer pl.Close()
+	var x int
+	pl.Eval(`$x = 7`)
+	if orig.Eval(`$x`, &x); x != 5 {
+		t.Errorf("$x in the original => %d", x)
+	}
+	if pl.Eval(`$x`, &x); x != 7 {
+		t.Errorf("$x in the clone => %d", x)
+	}
+
+	// the clone can run while the original does
+	done := make(chan bool)
+	go func() {
+		var v int
+		orig.Eval(`my $n = 0; $n += $cb->(1) for 1 .. 1000; $n`, &v)
+		if v != 2000 {
+			t.Errorf("callback in the original => %d", v)
+		}
+		done <- true
+	}()
+	var v int
+	pl.Eval(`my $n = 0; $n += $cb->(1) for 1 .. 1000; $n`, &v)
+	if v != 2000 {
+		t.Errorf("callback in the clone => %d", v)
+	}
+	<-done
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	pl.EvalContext(ctx, `1 while 1`, &err)
+	if err != context.DeadlineExceeded {
+		t.Errorf("EvalContext() in the clone => %v", err)
+	}
+
+	// Go values outlive the original
+	orig.Close()
+	if pl.Eval(`$cb->($st->{I})`, &v); v != 8 {
+		t.Errorf("callback after Close() of the original => %d", v)
+	}
+}
+
+func TestForeign(t *testing.T) {
+	other := plgo.New()
+	defer other.Close()
+	var perr error
+	pl.Eval(`die { code => 7 }`, &perr)
+	var take func(error) error
+	other.Eval(`sub { }`, &take)
+	if err := take(perr); err != plgo.ErrForeign {
+		t.Errorf("take() => %v", err)
+	}
+	// Go values are not tied to an interpreter
+	var id func(func() int) func() int
+	other.Eval(`sub { $_[0] }`, &id)
+	var call func(func() int) int
+	pl.Eval(`sub { $_[0]->() }`, &call)
+	if v := call(id(func() int { return 7 })); v != 7 {
+		t.Errorf("call() => %v", v)
+	}
+}
+
+func TestPinned(t *testing.T) {
+	pl, err := plgo.NewWithOptions(plgo.Options{Pinned: true})
+	if err != nil {
+		t.Fatalf("NewWithOptions() => %v", err)
+	}
+	defer pl.Close()
+	var tids sync.Map
+	var call func(func() int) int
+	pl.Eval(`sub { $_[0]->() + 1 }`, &call)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				v := call(func() int {
+					tids.Store(syscall.Gettid(), true)
+					// re-entrant calls stay on the thread
+					var n int
+					pl.Eval(`41`, &n)
+					return n
+				})
+				if v != 42 {
+					t.Errorf("call() => %v", v)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	n := 0
+	tids.Range(func(k, v interface{}) bool {
+		n++
+		return true
+	})
+	if n != 1 {
+		t.Errorf("callbacks ran on %d threads", n)
+	}
+
+	pl.Eval(`our $g = 3`)
+	cl, err := pl.Clone()
+	if err != nil {
+		t.Fatalf("Clone() => %v", err)
+	}
+	var v int
+	if cl.Eval(`$g`, &v); v != 3 {
+		t.Errorf("Eval() in a pinned clone => %v", v)
+	}
+	if err = cl.Close(); err != nil {
+		t.Errorf("Close() => %v", err)
+	}
+	cl.Eval(`1`, &err)
+	if err != plgo.ErrClosed {
+		t.Errorf("Eval() after Close() => %v", err)
+	}
+}
+
+func TestReentrant(t *testing.T) {
+	pl := plgo.New()
+	defer pl.Close()
+	var outer func(func())
+	pl.Eval(`our @order; sub { $_[0]->(); push @order, "outer" }`, &outer)
+	done := make(chan bool, 2)
+	outer(func() {
+		// other goroutines wait for the outermost call to return
+		go func() {
+			pl.Eval(`push @order, "other"`)
+			done <- true
+		}()
+		pl.Post(func(pl *plgo.PL) {
+			pl.Eval(`push @order, "posted"`)
+			done <- true
+		})
+		time.Sleep(20 * time.Millisecond)
+		// while this goroutine's calls go right ahead
+		pl.Eval(`push @order, "inner"`)
+	})
+	<-done
+	<-done
+	var order []string
+	pl.Eval(`\@order`, &order)
+	if len(order) != 4 || order[0] != "inner" || order[1] != "outer" {
+		t.Errorf("@order => %q", order)
+	}
+
+	// a Perl sub called back from a callback on another PL
+	other := plgo.New()
+	defer other.Close()
+	var viaOther func(func() int) int
+	other.Eval(`sub { $_[0]->() }`, &viaOther)
+	var fn func() int
+	pl.Eval(`sub { 7 }`, &fn)
+	var call func(func() int) int
+	pl.Eval(`sub { $_[0]->() + 1 }`, &call)
+	if v := call(func() int { return viaOther(fn) }); v != 8 {
+		t.Errorf("call() => %v", v)
+	}
+
+	var closeIt func(func() error) error
+	pl.Eval(`sub { $_[0]->() }`, &closeIt)
+	if err := closeIt(pl.Close); err == nil {
+		t.Errorf("Close() from a callback should fail")
+	}
+}
+
+func TestAsync(t *testing.T) {
+	pl := plgo.New()
+	defer pl.Close()
+	ctx := context.Background()
+
+	f := pl.EvalAsync(ctx, `2 + 3, "five"`)
+	<-f.Done()
+	var n int
+	var s string
+	if err := f.Wait(&n, &s); err != nil || n != 5 || s != "five" {
+		t.Errorf("EvalAsync() => %v, %q, %v", n, s, err)
+	}
+	f = pl.EvalAsync(ctx, `die "boom\n"`)
+	if err := f.Wait(); err == nil || err.Error() != "boom\n" {
+		t.Errorf("EvalAsync(die) => %v", err)
+	}
+
+	// bound funcs returning a Future run from the Post() queue in order
+	var push func(...interface{}) *plgo.Future
+	pl.Eval(`our @log; sub { push @log, @_; scalar @log }`, &push)
+	var futs []*plgo.Future
+	for i := 0; i < 5; i++ {
+		futs = append(futs, push(i))
+	}
+	for i, f := range futs {
+		if err := f.Wait(&n); err != nil || n != i+1 {
+			t.Errorf("push(%d) => %v, %v", i, n, err)
+		}
+	}
+	var sq func(int) *plgo.Future
+	pl.Eval(`sub { ($_[0] ** 2, "sq") }`, &sq)
+	if err := sq(4).Wait(&n, &s); err != nil || n != 16 || s != "sq" {
+		t.Errorf("sq(4) => %v, %q, %v", n, s, err)
+	}
+
+	var spin func(context.Context) *plgo.Future
+	pl.Eval(`sub { 1 while 1 }`, &spin)
+	tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := spin(tctx).Wait(); err != context.DeadlineExceeded {
+		t.Errorf("spin() => %v", err)
+	}
+
+	pl.Close()
+	if err := pl.EvalAsync(ctx, `1`).Wait(); err != plgo.ErrClosed {
+		t.Errorf("EvalAsync() after Close() => %v", err)
+	}
+}
+
 func TestBool(t *testing.T) {
 	var id func(bool) bool
 	pl.Eval(`sub { $_[0] }`, &id)
@@ -649,6 +1294,30 @@ func TestBuf(t *testing.T) {
 		t.Errorf("cnv(%v []byte) => %v", want, have)
 	}
 
+	// strings and lists of numbers both fill a []byte
+	var buf ABuf
+	pl.Eval(`"\0\xff\x80"`, &buf)
+	if !reflect.DeepEqual(buf, ABuf{0, 255, 128}) {
+		t.Errorf("string => %v", buf)
+	}
+	pl.Eval(`[ 1, 2, 3 ]`, &buf)
+	if !reflect.DeepEqual(buf, ABuf{1, 2, 3}) {
+		t.Errorf("list => %v", buf)
+	}
+	big := bytes.Repeat([]byte("blob"), 1<<20)
+	var blob func([]byte) []byte
+	pl.Eval(`sub { $_[0] . "!" }`, &blob)
+	if have := blob(big); len(have) != len(big)+1 || !bytes.Equal(have[:len(big)], big) {
+		t.Errorf("blob() => %d bytes", len(have))
+	}
+	var arr [3]byte
+	var str func([3]byte) string
+	pl.Eval(`sub { $_[0] }`, &str)
+	arr[0], arr[1], arr[2] = 'a', 'b', 'c'
+	if have := str(arr); have != "abc" {
+		t.Errorf("str([3]byte) => %q", have)
+	}
+
 	leak(t, 1024, ABuf{'x', 'y'}, `"xy"`)
 }
 
@@ -667,6 +1336,56 @@ func TestString(t *testing.T) {
 	leak(t, 1024, "uuu", `"vvv"`)
 }
 
+func TestHandle(t *testing.T) {
+	// Go readers and writers are usable as Perl filehandles
+	var lines func(io.Reader) []string
+	pl.Eval(`sub { my($fh) = @_; return [ <$fh> ] }`, &lines)
+	have := lines(strings.NewReader("a\nb\nc"))
+	want := []string{"a\n", "b\n", "c"}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("readline => %q", have)
+	}
+
+	var cat func(io.Reader, io.Writer) error
+	pl.Eval(`sub {
+		my($in, $out) = @_;
+		binmode $in;
+		while(read $in, my($buf), 3) {
+			printf $out '[%s]', $buf;
+		}
+		close $out or die;
+		return eof($in) ? () : die 'not at eof';
+	}`, &cat)
+	var buf bytes.Buffer
+	if err := cat(strings.NewReader("abcdefg"), &buf); err != nil {
+		t.Errorf("cat: %s", err.Error())
+	}
+	if buf.String() != "[abc][def][g]" {
+		t.Errorf("cat => %q", buf.String())
+	}
+
+	// and Perl filehandles are usable as io interfaces
+	var rd io.ReadCloser
+	pl.Eval(`my $s = "one\ntwo\n"; open my($fh), '<', \$s or die; $fh`, &rd)
+	data, err := io.ReadAll(rd)
+	if err != nil || string(data) != "one\ntwo\n" {
+		t.Errorf("io.ReadAll() => %q, %v", data, err)
+	}
+	if err = rd.Close(); err != nil {
+		t.Errorf("Close() => %v", err)
+	}
+
+	var get func() string
+	var wr io.WriteCloser
+	pl.Eval(`my $s = ''; open my($fh), '>', \$s or die; (sub { $s }, $fh)`,
+		&get, &wr)
+	fmt.Fprintf(wr, "x=%d", 5)
+	wr.Close()
+	if get() != "x=5" {
+		t.Errorf("fmt.Fprintf() => %q", get())
+	}
+}
+
 func TestStruct(t *testing.T) {
 	// struct passing is not yet symmetric
 	var id func(AStruct) AStruct
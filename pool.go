@@ -0,0 +1,222 @@
+package plgo
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// ErrPoolClosed is returned by Get() once the Pool is closed.
+var ErrPoolClosed = errors.New("pool is closed")
+
+// ErrForeignPL is the panic value of Put() given a PL that the Pool did
+// not hand out.
+var ErrForeignPL = errors.New("PL is not from this pool")
+
+// PoolConfig configures a Pool created by NewPool().
+type PoolConfig struct {
+	// New creates an interpreter, or NewWithOptions(Options{}) is
+	// used if nil.
+	New func() (*PL, error)
+	// Init, if set, prepares each new interpreter before its first
+	// use, e.g. setting the Preamble and loading modules.
+	Init func(*PL) error
+	// MaxSize bounds how many interpreters the Pool holds at once,
+	// idle or in use, GOMAXPROCS if not set.  Get() waits when all
+	// are in use.
+	MaxSize int
+	// Interpreters idle for longer than IdleTimeout are closed, if
+	// it is set.
+	IdleTimeout time.Duration
+	// An interpreter is closed rather than reused once it has been
+	// handed out MaxUses times, or once Live() exceeds MaxLive, if
+	// they are set.
+	MaxUses int
+	MaxLive int
+}
+
+// Pool shares interpreters between goroutines, each PL still only
+// runs one call at a time but work spread across a Pool may run in
+// parallel.
+type Pool struct {
+	cfg   PoolConfig
+	sem   chan struct{} // a slot for every PL idle or in use
+	done  chan struct{} // closed by Close()
+	mx    sync.Mutex    // guards the rest
+	idle  []*poolEnt    // most recently used last
+	inUse map[*PL]*poolEnt
+}
+
+type poolEnt struct {
+	pl   *PL
+	uses int
+	last time.Time
+}
+
+// NewPool creates an empty Pool, interpreters are created by Get() as
+// they are needed.
+func NewPool(cfg PoolConfig) *Pool {
+	if cfg.MaxSize < 1 {
+		cfg.MaxSize = runtime.GOMAXPROCS(0)
+	}
+	if cfg.New == nil {
+		cfg.New = func() (*PL, error) { return NewWithOptions(Options{}) }
+	}
+	p := &Pool{
+		cfg:   cfg,
+		sem:   make(chan struct{}, cfg.MaxSize),
+		done:  make(chan struct{}),
+		inUse: make(map[*PL]*poolEnt),
+	}
+	if cfg.IdleTimeout > 0 {
+		go p.evict()
+	}
+	return p
+}
+
+// Get takes an interpreter from the Pool, creating one if none are
+// idle.  It must be handed back with Put().
+func (p *Pool) Get(ctx context.Context) (*PL, error) {
+	select {
+	case <-p.done:
+		return nil, ErrPoolClosed
+	default:
+	}
+	select {
+	case p.sem <- struct{}{}:
+	case <-p.done:
+		return nil, ErrPoolClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	p.mx.Lock()
+	var ent *poolEnt
+	if n := len(p.idle); n > 0 {
+		ent = p.idle[n-1]
+		p.idle = p.idle[:n-1]
+	}
+	p.mx.Unlock()
+	if ent == nil {
+		pl, err := p.create()
+		if err != nil {
+			<-p.sem
+			return nil, err
+		}
+		ent = &poolEnt{pl: pl}
+	}
+	ent.uses++
+	p.mx.Lock()
+	p.inUse[ent.pl] = ent
+	p.mx.Unlock()
+	return ent.pl, nil
+}
+
+func (p *Pool) create() (*PL, error) {
+	pl, err := p.cfg.New()
+	if err != nil {
+		return nil, err
+	}
+	if p.cfg.Init != nil {
+		if err = p.cfg.Init(pl); err != nil {
+			pl.Close()
+			return nil, err
+		}
+	}
+	return pl, nil
+}
+
+// Put returns an interpreter taken by Get(), it may be closed rather
+// than kept for reuse.  Any other PL panics with ErrForeignPL.
+func (p *Pool) Put(pl *PL) {
+	p.mx.Lock()
+	ent, ok := p.inUse[pl]
+	delete(p.inUse, pl)
+	p.mx.Unlock()
+	if !ok {
+		panic(ErrForeignPL)
+	}
+	keep := !pl.closed() &&
+		(p.cfg.MaxUses <= 0 || ent.uses < p.cfg.MaxUses) &&
+		(p.cfg.MaxLive <= 0 || pl.Live() <= p.cfg.MaxLive)
+	if keep {
+		ent.last = time.Now()
+		p.mx.Lock()
+		select {
+		case <-p.done:
+			keep = false
+		default:
+			p.idle = append(p.idle, ent)
+		}
+		p.mx.Unlock()
+	}
+	if !keep {
+		pl.Close()
+	}
+	<-p.sem
+}
+
+// Do runs f with an interpreter from the Pool.
+func (p *Pool) Do(ctx context.Context, f func(*PL) error) error {
+	pl, err := p.Get(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.Put(pl)
+	return f(pl)
+}
+
+// evict closes interpreters that sit idle too long
+func (p *Pool) evict() {
+	// check twice per timeout, within reason for tiny ones
+	tick := time.NewTicker(max(p.cfg.IdleTimeout/2, time.Millisecond))
+	defer tick.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case now := <-tick.C:
+			var old []*poolEnt
+			p.mx.Lock()
+			// idle is ordered by last use, so the stale ones
+			// are at the front
+			n := 0
+			for n < len(p.idle) && now.Sub(p.idle[n].last) >= p.cfg.IdleTimeout {
+				n++
+			}
+			old = append(old, p.idle[:n]...)
+			p.idle = append(p.idle[:0], p.idle[n:]...)
+			p.mx.Unlock()
+			for _, ent := range old {
+				ent.pl.Close()
+			}
+		}
+	}
+}
+
+// Idle reports how many interpreters are waiting in the Pool.
+func (p *Pool) Idle() int {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	return len(p.idle)
+}
+
+// Close closes the idle interpreters, those in use are closed as they
+// are Put() back.
+func (p *Pool) Close() {
+	p.mx.Lock()
+	select {
+	case <-p.done:
+		p.mx.Unlock()
+		return
+	default:
+	}
+	close(p.done)
+	idle := p.idle
+	p.idle = nil
+	p.mx.Unlock()
+	for _, ent := range idle {
+		ent.pl.Close()
+	}
+}
@@ -0,0 +1,138 @@
+package plgo_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tlby/plgo"
+)
+
+func TestPool(t *testing.T) {
+	var made int32
+	p := plgo.NewPool(plgo.PoolConfig{
+		Init: func(pl *plgo.PL) error {
+			atomic.AddInt32(&made, 1)
+			pl.Eval(`sub triple { 3 * shift }`)
+			return nil
+		},
+		MaxSize: 2,
+		MaxUses: 3,
+	})
+	defer p.Close()
+
+	var wg sync.WaitGroup
+	var busy, most int32
+	for i := 0; i < 12; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := p.Do(context.Background(), func(pl *plgo.PL) error {
+				n := atomic.AddInt32(&busy, 1)
+				defer atomic.AddInt32(&busy, -1)
+				for {
+					m := atomic.LoadInt32(&most)
+					if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+						break
+					}
+				}
+				var v int
+				var err error
+				pl.Eval(`triple(`+string(rune('0'+i%10))+`)`, &v, &err)
+				if err == nil && v != 3*(i%10) {
+					t.Errorf("triple(%d) => %d", i%10, v)
+				}
+				time.Sleep(time.Millisecond)
+				return err
+			})
+			if err != nil {
+				t.Errorf("Do() => %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if most > 2 {
+		t.Errorf("%d interpreters in use at once", most)
+	}
+	// 12 uses at no more than 3 per interpreter
+	if made < 4 || made > 6 {
+		t.Errorf("made %d interpreters", made)
+	}
+
+	// Get() waits for a free interpreter
+	a, _ := p.Get(context.Background())
+	b, _ := p.Get(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Get() when full => %v", err)
+	}
+	p.Put(a)
+	p.Put(b)
+
+	// only PLs it handed out go back
+	func() {
+		defer func() {
+			if r := recover(); r != plgo.ErrForeignPL {
+				t.Errorf("Put(twice) => %v", r)
+			}
+		}()
+		p.Put(a)
+	}()
+
+	p.Close()
+	if _, err := p.Get(context.Background()); err != plgo.ErrPoolClosed {
+		t.Errorf("Get() after Close() => %v", err)
+	}
+	if p.Idle() != 0 {
+		t.Errorf("Idle() after Close() => %d", p.Idle())
+	}
+}
+
+func TestPoolRecycle(t *testing.T) {
+	p := plgo.NewPool(plgo.PoolConfig{
+		MaxSize:     1,
+		IdleTimeout: 20 * time.Millisecond,
+		MaxLive:     100000,
+	})
+	defer p.Close()
+	pl, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("Get() => %v", err)
+	}
+	p.Put(pl)
+	if p.Idle() != 1 {
+		t.Errorf("Idle() => %d", p.Idle())
+	}
+	time.Sleep(100 * time.Millisecond)
+	if p.Idle() != 0 {
+		t.Errorf("Idle() after IdleTimeout => %d", p.Idle())
+	}
+
+	// even a tiny IdleTimeout works
+	tiny := plgo.NewPool(plgo.PoolConfig{IdleTimeout: 1})
+	defer tiny.Close()
+	tiny.Do(context.Background(), func(*plgo.PL) error { return nil })
+	time.Sleep(50 * time.Millisecond)
+	if tiny.Idle() != 0 {
+		t.Errorf("Idle() after 1ns IdleTimeout => %d", tiny.Idle())
+	}
+
+	p.Do(context.Background(), func(pl *plgo.PL) error {
+		pl.Eval(`push our @keep, [] for 1 .. 200000`)
+		return nil
+	})
+	if p.Idle() != 0 {
+		t.Errorf("Idle() after MaxLive => %d", p.Idle())
+	}
+	p.Do(context.Background(), func(pl *plgo.PL) error {
+		var n int
+		pl.Eval(`scalar our @keep`, &n)
+		if n != 0 {
+			t.Errorf("recycled interpreter has %d values", n)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,41 @@
+package plgo
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// EvalAs is Eval() for a single result of type T, returning it rather
+// than filling in a pointer.
+func EvalAs[T any](pl *PL, text string) (v T, err error) {
+	pl.Eval(text, &v, &err)
+	return
+}
+
+// Func is EvalAs() for a func type F, so the code should evaluate to a
+// code ref.  Go can't constrain F to func types, so any other F is an
+// error.
+func Func[F any](pl *PL, text string) (f F, err error) {
+	if t := reflect.TypeOf(&f).Elem(); t.Kind() != reflect.Func {
+		return f, fmt.Errorf("%s is not a func type", t)
+	}
+	pl.Eval(text, &f, &err)
+	return
+}
+
+// Call calls the Perl sub called name with args, in scalar context, and
+// converts its result to R.  Unqualified names are looked up in main.
+func Call[R any](pl *PL, name string, args ...interface{}) (r R, err error) {
+	var call func(string, []interface{}) (R, error)
+	err = pl.do(func(pl *PL, errf errFunc) {
+		if pl.nameCall == nil {
+			pl.evalTrusted(`sub { no strict 'refs'; my($n, $a) = @_; &{"main::$n"}(@$a) }`, &pl.nameCall)
+		}
+		dst := reflect.ValueOf(&call).Elem()
+		pl.decode(&dst, pl.nameCall.sv, errf)
+	})
+	if err != nil {
+		return
+	}
+	return call(name, args)
+}
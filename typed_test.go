@@ -0,0 +1,45 @@
+package plgo_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tlby/plgo"
+)
+
+func TestTyped(t *testing.T) {
+	pl := plgo.New()
+	defer pl.Close()
+
+	if v, err := plgo.EvalAs[int](pl, `6 * 7`); err != nil || v != 42 {
+		t.Errorf("EvalAs() => %v, %v", v, err)
+	}
+	if v, err := plgo.EvalAs[[]string](pl, `[ qw(a b) ]`); err != nil || strings.Join(v, "") != "ab" {
+		t.Errorf("EvalAs() => %q, %v", v, err)
+	}
+	if _, err := plgo.EvalAs[int](pl, `die "oops\n"`); err == nil || err.Error() != "oops\n" {
+		t.Errorf("EvalAs() => %v", err)
+	}
+
+	up, err := plgo.Func[func(string) string](pl, `sub { uc shift }`)
+	if err != nil || up("abc") != "ABC" {
+		t.Errorf("Func() => %v", err)
+	}
+	if _, err := plgo.Func[int](pl, `sub { }`); err == nil {
+		t.Errorf("Func[int] should fail")
+	}
+
+	pl.Eval(`sub add { my $t = 0; $t += $_ for @_; $t } package Util; sub hi { "hi $_[0]" }`)
+	if v, err := plgo.Call[int](pl, "add", 1, 2, 3); err != nil || v != 6 {
+		t.Errorf("Call(add) => %v, %v", v, err)
+	}
+	if v, err := plgo.Call[int](pl, "add"); err != nil || v != 0 {
+		t.Errorf("Call(add) => %v, %v", v, err)
+	}
+	if v, err := plgo.Call[string](pl, "Util::hi", "there"); err != nil || v != "hi there" {
+		t.Errorf("Call(Util::hi) => %q, %v", v, err)
+	}
+	if _, err := plgo.Call[int](pl, "nosuch"); err == nil {
+		t.Errorf("Call(nosuch) should fail")
+	}
+}
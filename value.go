@@ -0,0 +1,93 @@
+package plgo
+
+// #include "glue.h"
+import "C"
+import (
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Value is a Perl value held as is rather than converted, Eval() or a
+// bound func fills in a *Value like any other type, and it can be
+// handed back to Perl the same way.
+type Value struct {
+	sv *sV
+}
+
+var valueType = reflect.TypeOf((*Value)(nil))
+
+// Bytes calls f with the string in v, without copying it out of Perl.
+// The PL is held while f runs, so f must not call into it, and the
+// slice is only good until f returns.
+func (v *Value) Bytes(f func([]byte)) (err error) {
+	pl := v.sv.pl
+	pl.exec(func() {
+		if !pl.acquire() {
+			err = ErrClosed
+			return
+		}
+		defer pl.leave()
+		var str *C.char
+		var n C.STRLEN
+		C.glue_getPV(pl.thx, &str, &n, v.sv.sv)
+		f(unsafe.Slice((*byte)(unsafe.Pointer(str)), int(n)))
+	})
+	return
+}
+
+// View is a []byte that Perl reads as a read-only string.  Perl
+// expects a NUL after the end of a string, so it only reads the buffer
+// in place when the byte past the end, within cap(), is already a NUL,
+// as with append(data, 0)[:len(data)].  Otherwise it is copied once.
+// The buffer stays pinned until Perl is done with the string, and must
+// not be changed meanwhile.
+type View []byte
+
+var viewType = reflect.TypeOf(View(nil))
+
+// Views are shared by clones of an interpreter, so they live in one
+// registry.
+var (
+	viewSeq uint64
+	views   sync.Map // uint => *viewEnt
+)
+
+type viewEnt struct {
+	refs int32
+	pin  runtime.Pinner
+}
+
+func (pl *PL) newView(ptr **C.SV, buf []byte) {
+	if len(buf) == 0 {
+		C.glue_setPVB(pl.thx, ptr, nil, 0)
+		return
+	}
+	if cap(buf) == len(buf) || buf[:len(buf)+1][len(buf)] != 0 {
+		nul := make([]byte, len(buf)+1)
+		copy(nul, buf)
+		buf = nul[:len(buf)]
+	}
+	ent := &viewEnt{refs: 1}
+	ent.pin.Pin(&buf[0])
+	id := uint(atomic.AddUint64(&viewSeq, 1))
+	views.Store(id, ent)
+	C.glue_setView(pl.thx, ptr, (*C.char)(unsafe.Pointer(&buf[0])), C.STRLEN(len(buf)), C.UV(id))
+}
+
+//export goDupView
+func goDupView(id uint) {
+	ent, _ := views.Load(id)
+	atomic.AddInt32(&ent.(*viewEnt).refs, 1)
+}
+
+//export goReleaseView
+func goReleaseView(id uint) {
+	ent, _ := views.Load(id)
+	if atomic.AddInt32(&ent.(*viewEnt).refs, -1) == 0 {
+		views.Delete(id)
+		ent.(*viewEnt).pin.Unpin()
+	}
+}
@@ -0,0 +1,68 @@
+package plgo_test
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/tlby/plgo"
+)
+
+func TestValue(t *testing.T) {
+	pl := plgo.New()
+	defer pl.Close()
+
+	var v *plgo.Value
+	pl.Eval(`"ab" x 1000`, &v)
+	var n int
+	v.Bytes(func(buf []byte) {
+		n = bytes.Count(buf, []byte("b"))
+	})
+	if n != 1000 {
+		t.Errorf("Bytes() saw %d b", n)
+	}
+	var length func(*plgo.Value) int
+	pl.Eval(`sub { length $_[0] }`, &length)
+	if have := length(v); have != 2000 {
+		t.Errorf("length() => %v", have)
+	}
+
+	// Perl reads a View in place, but can't change it
+	buf := []byte(strings.Repeat("xyz", 100))
+	var count func(plgo.View) int
+	pl.Eval(`sub { $_[0] =~ tr/y// }`, &count)
+	if have := count(buf); have != 100 {
+		t.Errorf("count() => %v", have)
+	}
+	var poke func(plgo.View) error
+	pl.Eval(`sub { $_[0] .= "!"; return }`, &poke)
+	if err := poke(buf); err == nil || !strings.Contains(err.Error(), "read-only") {
+		t.Errorf("poke() => %v", err)
+	}
+	// it lives on as long as Perl holds it
+	var keep func(plgo.View)
+	pl.Eval(`sub { our $kept = \$_[0]; return }`, &keep)
+	keep(plgo.View("kept view"))
+	runtime.GC()
+	var kept string
+	pl.Eval(`${ our $kept }`, &kept)
+	if kept != "kept view" {
+		t.Errorf("$kept => %q", kept)
+	}
+	// Perl never reads past the end
+	var num func(plgo.View) float64
+	pl.Eval(`sub { $_[0] + 0 }`, &num)
+	big := []byte("1.5e3999")
+	if have := num(big[:3]); have != 1.5 {
+		t.Errorf("num(1.5) => %v", have)
+	}
+	nul := append([]byte("2.5"), 0, '9')
+	if have := num(nul[:3]); have != 2.5 {
+		t.Errorf("num(2.5) => %v", have)
+	}
+	pl.Eval(`undef our $kept`)
+	if have := count(nil); have != 0 {
+		t.Errorf("count(nil) => %v", have)
+	}
+}